@@ -0,0 +1,227 @@
+package regia
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// Apache Common Log Format
+	AccessLogCommon = `{{.RemoteHost}} - {{or .User "-"}} [{{.Time}}] "{{.Method}} {{.URI}} {{.Proto}}" {{.Status}} {{.SizeCLF}}`
+
+	// Apache Combined Log Format
+	AccessLogCombined = AccessLogCommon + ` {{quote .Referer}} {{quote .UserAgent}}`
+
+	// One JSON object per line, the keys are the json tags of AccessLogEntry
+	AccessLogJson = "json"
+
+	defaultRequestIDHeader = "X-Request-Id"
+	clfTimeFormat          = "02/Jan/2006:15:04:05 -0700"
+)
+
+type AccessLogOptions struct {
+	// default os.Stdout
+	Writer io.Writer
+
+	// AccessLogCommon, AccessLogCombined, AccessLogJson or a text/template of AccessLogEntry,
+	// such as `{{.Method}} {{.Route}} {{.Status}} {{.Latency}} {{.Header "X-Tenant"}}`,
+	// default AccessLogCombined
+	Format string
+
+	// Requests are not logged if the path is in the list,
+	// the item ends with `/` skips the path with the prefix, such as `/static/`
+	Skip []string
+
+	// The ratio of the successful requests to log, between 0 and 1, default 1.
+	// The requests responded with status >= 400 are always logged
+	SampleRate float64
+
+	// The header carries the request id, it is looked up in the request then the response,
+	// default `X-Request-Id`
+	RequestIDHeader string
+}
+
+// AccessLogEntry is the data of a line of access log
+type AccessLogEntry struct {
+	Start      time.Time     `json:"time"`
+	RemoteHost string        `json:"remote_host"`
+	User       string        `json:"user,omitempty"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Path       string        `json:"path"`
+	Route      string        `json:"route,omitempty"`
+	Proto      string        `json:"proto"`
+	Status     int           `json:"status"`
+	Size       int64         `json:"size"`
+	Latency    time.Duration `json:"-"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+	RequestID  string        `json:"request_id,omitempty"`
+
+	ctx *Context
+}
+
+// Time is the start time in the Common Log Format, such as `10/Oct/2000:13:55:36 -0700`
+func (a *AccessLogEntry) Time() string { return a.Start.Format(clfTimeFormat) }
+
+// SizeCLF returns `-` if no body sent
+func (a *AccessLogEntry) SizeCLF() string {
+	if a.Size == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(a.Size, 10)
+}
+
+// Header returns the value of the request header
+func (a *AccessLogEntry) Header(key string) string { return a.ctx.Raw.Request.Header.Get(key) }
+
+// ResponseHeader returns the value of the response header
+func (a *AccessLogEntry) ResponseHeader(key string) string { return a.ctx.Raw.Writer.Header().Get(key) }
+
+// MarshalJSON adds the latency in milliseconds
+func (a *AccessLogEntry) MarshalJSON() ([]byte, error) {
+	type entry AccessLogEntry
+	return json.Marshal(struct {
+		*entry
+		Latency float64 `json:"latency_ms"`
+	}{entry: (*entry)(a), Latency: float64(a.Latency) / float64(time.Millisecond)})
+}
+
+var accessLogFuncs = template.FuncMap{
+	// quote the value like apache, `-` for empty
+	"quote": func(value string) string {
+		if value == "" {
+			return `"-"`
+		}
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+	},
+}
+
+// AccessLogMiddleware writes a line for every request after it is responded,
+// use it with Engine.AddInterceptors to log the requests not matched too.
+// It panics if the Format is an invalid template.
+//
+//	engine.AddInterceptors(regia.AccessLogMiddleware(regia.AccessLogOptions{
+//		Format: regia.AccessLogJson,
+//		Skip:   []string{"/healthz", "/static/"},
+//	}))
+func AccessLogMiddleware(options ...AccessLogOptions) HandleFunc {
+	var o AccessLogOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	if o.Writer == nil {
+		o.Writer = os.Stdout
+	}
+	if o.Format == "" {
+		o.Format = AccessLogCombined
+	}
+	if o.RequestIDHeader == "" {
+		o.RequestIDHeader = defaultRequestIDHeader
+	}
+	var tmpl *template.Template
+	if o.Format != AccessLogJson {
+		tmpl = template.Must(template.New("access_log").Funcs(accessLogFuncs).Parse(o.Format))
+	}
+	var mu sync.Mutex
+	write := func(ctx *Context, start time.Time, status int) {
+		entry := newAccessLogEntry(ctx, start, o.RequestIDHeader)
+		if status != 0 {
+			entry.Status = status
+		}
+		if entry.Status < 400 && o.SampleRate > 0 && o.SampleRate < 1 && rand.Float64() >= o.SampleRate {
+			return
+		}
+		buffer := &bytes.Buffer{}
+		if tmpl == nil {
+			_ = json.NewEncoder(buffer).Encode(entry)
+		} else if err := tmpl.Execute(buffer, entry); err != nil {
+			ctx.Engine.Logger.Error("access log", F("error", err))
+			return
+		} else {
+			buffer.WriteByte('\n')
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = o.Writer.Write(buffer.Bytes())
+	}
+	return func(ctx *Context) {
+		if skipAccessLog(ctx.Raw.Request.URL.Path, o.Skip) {
+			ctx.Next()
+			return
+		}
+		start := time.Now()
+		defer func() {
+			rec := recover()
+			status := 0
+			switch e := rec.(type) {
+			case nil:
+			case Exit:
+				// run the Exit of Abort first to log what it responds,
+				// the done exit keeps unwinding so the handlers after the aborted one don't run
+				e.Exit(ctx)
+				rec = exit{}
+			default:
+				status = http.StatusInternalServerError
+			}
+			write(ctx, start, status)
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+func skipAccessLog(path string, skip []string) bool {
+	for _, item := range skip {
+		if path == item || strings.HasSuffix(item, "/") && strings.HasPrefix(path, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func newAccessLogEntry(ctx *Context, start time.Time, requestIDHeader string) *AccessLogEntry {
+	request := ctx.Raw.Request
+	entry := &AccessLogEntry{
+		Start:      start,
+		RemoteHost: request.RemoteAddr,
+		Method:     request.Method,
+		URI:        request.RequestURI,
+		Path:       request.URL.Path,
+		Route:      ctx.Route(),
+		Proto:      request.Proto,
+		Status:     ctx.Response.StatusCode(),
+		Size:       ctx.Response.Size(),
+		Latency:    time.Since(start),
+		Referer:    request.Referer(),
+		UserAgent:  request.UserAgent(),
+		RequestID:  request.Header.Get(requestIDHeader),
+		ctx:        ctx,
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		entry.RemoteHost = host
+	}
+	if user, _, ok := request.BasicAuth(); ok && user != "" {
+		entry.User = user
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = ctx.Raw.Writer.Header().Get(requestIDHeader)
+	}
+	if entry.Status == 0 {
+		// net/http responds 200 if nothing written
+		entry.Status = http.StatusOK
+	}
+	return entry
+}
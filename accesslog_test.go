@@ -0,0 +1,200 @@
+package regia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// statusExit responds the status when the request is aborted
+type statusExit int
+
+func (s statusExit) Exit(ctx *Context) { ctx.Response.SetStatus(int(s)) }
+
+func accessLogEngine(options AccessLogOptions) (*Engine, *bytes.Buffer) {
+	buffer := &bytes.Buffer{}
+	options.Writer = buffer
+	engine := New()
+	engine.AddInterceptors(AccessLogMiddleware(options))
+	engine.GET("/users/:id", func(ctx *Context) {
+		ctx.Response.SetHeader("X-Request-Id", "resp-1")
+		_, _ = ctx.Response.String("hello")
+	})
+	engine.GET("/empty", func(ctx *Context) { ctx.Response.SetStatus(http.StatusNoContent) })
+	engine.GET("/static/app.js", func(ctx *Context) { _, _ = ctx.Response.String("js") })
+	engine.GET("/healthz", func(ctx *Context) { _, _ = ctx.Response.String("ok") })
+	_ = engine.init()
+	return engine, buffer
+}
+
+func newAccessLogRequest(target string) *http.Request {
+	request := httptest.NewRequest("GET", target, nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	return request
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	request := func() *http.Request {
+		request := newAccessLogRequest("/users/1?x=1")
+		request.SetBasicAuth("ivy", "secret")
+		request.Header.Set("User-Agent", `curl/8.0 "test"`)
+		return request
+	}
+	clf := `^192\.0\.2\.1 - ivy \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/1\?x=1 HTTP/1\.1" 200 5`
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{AccessLogCommon, clf + `$`},
+		{"", clf + ` "-" "curl/8\.0 \\"test\\""$`},
+		{AccessLogCombined, clf + ` "-" "curl/8\.0 \\"test\\""$`},
+		{`{{.Route}} {{.Path}} {{.RequestID}} {{.Header "User-Agent"}} {{.ResponseHeader "Content-Type"}}`, `^/users/:id /users/1 resp-1 curl/8.0 "test" text/html`},
+	}
+	for _, test := range tests {
+		engine, buffer := accessLogEngine(AccessLogOptions{Format: test.format})
+		engine.ServeHTTP(httptest.NewRecorder(), request())
+		line := buffer.String()
+		if !strings.HasSuffix(line, "\n") || !regexp.MustCompile(test.want).MatchString(strings.TrimSuffix(line, "\n")) {
+			t.Errorf("format %q logged %q", test.format, line)
+		}
+	}
+
+	engine, buffer := accessLogEngine(AccessLogOptions{Format: AccessLogCommon})
+	engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/empty"))
+	if line := buffer.String(); !strings.HasSuffix(line, `"GET /empty HTTP/1.1" 204 -`+"\n") || !strings.HasPrefix(line, "192.0.2.1 - - [") {
+		t.Errorf("empty body logged %q", line)
+	}
+}
+
+func TestAccessLogJson(t *testing.T) {
+	engine, buffer := accessLogEngine(AccessLogOptions{Format: AccessLogJson})
+	request := newAccessLogRequest("/users/1")
+	request.Header.Set("Referer", "https://example.com/")
+	engine.ServeHTTP(httptest.NewRecorder(), request)
+	engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/missing"))
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %q", lines)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"remote_host": "192.0.2.1", "method": "GET", "uri": "/users/1", "path": "/users/1", "route": "/users/:id",
+		"proto": "HTTP/1.1", "status": float64(200), "size": float64(5), "referer": "https://example.com/", "request_id": "resp-1",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms = %v", entry["latency_ms"])
+	}
+	if _, ok := entry["time"].(string); !ok {
+		t.Errorf("time = %v", entry["time"])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["status"] != float64(404) {
+		t.Errorf("not found logged %s", lines[1])
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	engine, buffer := accessLogEngine(AccessLogOptions{Format: "{{.Path}}", Skip: []string{"/healthz", "/static/"}})
+	for _, path := range []string{"/healthz", "/static/app.js", "/healthz/deep", "/users/1"} {
+		engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest(path))
+	}
+	if got := buffer.String(); got != "/healthz/deep\n/users/1\n" {
+		t.Fatalf("logged %q", got)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	engine, buffer := accessLogEngine(AccessLogOptions{Format: "{{.Status}}", SampleRate: 1e-9})
+	for i := 0; i < 50; i++ {
+		engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/users/1"))
+	}
+	engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/missing"))
+	if got := buffer.String(); got != "404\n" {
+		t.Fatalf("logged %q, the errors are always logged", got)
+	}
+
+	engine, buffer = accessLogEngine(AccessLogOptions{Format: "{{.Status}}", SampleRate: 1})
+	for i := 0; i < 3; i++ {
+		engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/users/1"))
+	}
+	if got := buffer.String(); got != "200\n200\n200\n" {
+		t.Fatalf("logged %q", got)
+	}
+}
+
+func TestAccessLogAbort(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	var reached bool
+	engine := New()
+	engine.Abort = statusExit(http.StatusUnauthorized)
+	engine.Use(AccessLogMiddleware(AccessLogOptions{Writer: buffer, Format: "{{.Status}}"}))
+	engine.GET("/private", func(ctx *Context) { ctx.Abort() }, func(ctx *Context) { reached = true })
+	engine.GET("/panic", func(ctx *Context) { panic("boom") })
+	recorder := serveTest(t, engine, newAccessLogRequest("/private"))
+	if recorder.Code != http.StatusUnauthorized || buffer.String() != "401\n" || reached {
+		t.Fatalf("abort = %d, logged %q, handler after Abort reached %v", recorder.Code, buffer, reached)
+	}
+
+	buffer.Reset()
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Fatalf("recovered %v", rec)
+			}
+		}()
+		engine.ServeHTTP(httptest.NewRecorder(), newAccessLogRequest("/panic"))
+	}()
+	if buffer.String() != "500\n" {
+		t.Fatalf("panic logged %q", buffer)
+	}
+}
+
+func TestAccessLogInvalidFormat(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid format accepted")
+		}
+	}()
+	AccessLogMiddleware(AccessLogOptions{Format: "{{.Status"})
+}
+
+func TestResponseRecorder(t *testing.T) {
+	informational := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	informational.WriteHeader(http.StatusContinue)
+	if informational.status != 0 {
+		t.Fatalf("informational status recorded: %d", informational.status)
+	}
+
+	recorder := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	n, err := recorder.ReadFrom(strings.NewReader("hello"))
+	_, _ = recorder.Write([]byte(" world"))
+	recorder.WriteHeader(http.StatusNotFound)
+	if n != 5 || err != nil || recorder.status != http.StatusOK || recorder.size != 11 {
+		t.Fatalf("status %d, size %d, ReadFrom %d, %v", recorder.status, recorder.size, n, err)
+	}
+
+	flushed := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	flushed.Flush()
+	if flushed.status != http.StatusOK || !flushed.ResponseWriter.(*httptest.ResponseRecorder).Flushed {
+		t.Fatalf("Flush status = %d", flushed.status)
+	}
+	if _, _, err := flushed.Hijack(); !errors.Is(err, notHijackerError) || strings.HasPrefix(err.Error(), "websocket") {
+		t.Fatalf("Hijack = %v", err)
+	}
+	if err := flushed.Push("/app.js", nil); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("Push = %v", err)
+	}
+}
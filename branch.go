@@ -3,6 +3,7 @@ package regia
 import (
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 type handleNode struct {
@@ -14,6 +15,9 @@ type Branch struct {
 	methodsTree map[string][]*handleNode
 	middleware  HandleFuncGroup
 	prefix      string
+
+	// prefixes of the included branches
+	includes []string
 }
 
 func (b *Branch) Use(group ...HandleFunc) { b.middleware = append(b.middleware, group...) }
@@ -62,6 +66,13 @@ func (b *Branch) Handle(method, path string, group ...HandleFunc) {
 }
 
 func (b *Branch) Include(prefix string, branch *Branch) {
+	// the paths of the branch carry its own prefix set by SetPrefix
+	if full := strings.TrimSuffix(b.prefix+prefix+branch.prefix, "/"); full != "" {
+		b.includes = append(b.includes, full)
+	}
+	for _, include := range branch.includes {
+		b.includes = append(b.includes, b.prefix+prefix+include)
+	}
 	for method, nodes := range branch.methodsTree {
 		for _, node := range nodes {
 			b.Handle(method, prefix+node.path, node.group...)
@@ -88,6 +99,11 @@ func (b *Branch) BindMethod(path string, v interface{}, mappings ...map[string]s
 	b.Bind(path, v, mappings...)
 }
 
+// Prefixes returns the prefixes of all included branches
+func (b *Branch) Prefixes() []string {
+	return append([]string(nil), b.includes...)
+}
+
 func NewBranch() *Branch {
 	return &Branch{methodsTree: make(map[string][]*handleNode)}
 }
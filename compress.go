@@ -0,0 +1,324 @@
+package regia
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	gzipEncoding             = "gzip"
+	deflateEncoding          = "deflate"
+	defaultCompressMinLength = 1024
+)
+
+// Content types which are compressed already
+var DefaultCompressExcludedTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/x-bzip2", "application/x-xz", "application/zstd",
+}
+
+type CompressOptions struct {
+	// Compression level of gzip and deflate, nil means gzip.DefaultCompression,
+	// such as `level := flate.NoCompression; options.Level = &level`
+	Level *int
+
+	// Bodies smaller than it are sent without compression, nil means 1024,
+	// such as `minLength := 0; options.MinLength = &minLength` to compress every body
+	MinLength *int
+
+	// Prefixes of the content types which will not be compressed,
+	// default DefaultCompressExcludedTypes, `text/event-stream` is always excluded
+	ExcludedTypes []string
+}
+
+// compressEncoder is implemented by *gzip.Writer and *zlib.Writer
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(writer io.Writer)
+}
+
+// CompressInterceptor compresses the response with gzip or deflate negotiated by `Accept-Encoding`.
+// Small bodies, compressed content types, Server-Sent Events and WebSocket upgrades are skipped.
+//
+//	engine.AddInterceptors(regia.CompressInterceptor())
+func CompressInterceptor(options ...CompressOptions) HandleFunc {
+	var o CompressOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	level := gzip.DefaultCompression
+	if o.Level != nil {
+		level = *o.Level
+	}
+	minLength := defaultCompressMinLength
+	if o.MinLength != nil {
+		minLength = *o.MinLength
+	}
+	if o.ExcludedTypes == nil {
+		o.ExcludedTypes = DefaultCompressExcludedTypes
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic(err)
+	}
+	pools := map[string]*sync.Pool{
+		gzipEncoding: {New: func() interface{} {
+			writer, _ := gzip.NewWriterLevel(io.Discard, level)
+			return writer
+		}},
+		// the deflate coding of HTTP is the zlib format, not the raw deflate
+		deflateEncoding: {New: func() interface{} {
+			writer, _ := zlib.NewWriterLevel(io.Discard, level)
+			return writer
+		}},
+	}
+	return func(ctx *Context) {
+		request := ctx.Raw.Request
+		if request.Method == http.MethodHead || ctx.Request.Header().Get("Upgrade").String() != "" {
+			ctx.Next()
+			return
+		}
+		encoding := negotiateEncoding(ctx.Request.Header().AcceptEncoding())
+		if encoding == "" {
+			addVary(ctx.Response.Header(), "Accept-Encoding")
+			ctx.Next()
+			return
+		}
+		writer := &compressWriter{
+			ResponseWriter: ctx.Raw.Writer,
+			options:        &o,
+			minLength:      minLength,
+			encoding:       encoding,
+			pool:           pools[encoding],
+		}
+		rawWriter, responseWriter := ctx.Raw.Writer, ctx.Response.ResponseWriter
+		ctx.Raw.Writer, ctx.Response.ResponseWriter = writer, writer
+		defer func() {
+			writer.close()
+			ctx.Raw.Writer, ctx.Response.ResponseWriter = rawWriter, responseWriter
+		}()
+		ctx.Next()
+	}
+}
+
+// prefer gzip, identity is always acceptable
+func negotiateEncoding(accept AcceptList) string {
+	gzipQuality, deflateQuality := accept.Quality(gzipEncoding), accept.Quality(deflateEncoding)
+	if gzipQuality > 0 && gzipQuality >= deflateQuality {
+		return gzipEncoding
+	}
+	if deflateQuality > 0 {
+		return deflateEncoding
+	}
+	return ""
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field == "*" || strings.EqualFold(field, value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// compressWriter buffers the body until MinLength or Flush
+// to decide whether the response should be compressed
+type compressWriter struct {
+	http.ResponseWriter
+	options   *CompressOptions
+	minLength int
+	encoding  string
+	pool      *sync.Pool
+	encoder   compressEncoder
+	buffer    []byte
+	status    int
+	decided   bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	// informational responses are sent immediately
+	if c.decided || code >= 100 && code < 200 {
+		c.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if c.status != 0 {
+		return
+	}
+	c.status = code
+	if code == http.StatusNotModified {
+		// the same ETag as the compressed 200 response
+		weakenETag(c.Header())
+	}
+	if !bodyAllowedForStatus(code) || code == http.StatusPartialContent {
+		c.decide(false)
+	}
+}
+
+func (c *compressWriter) Write(data []byte) (int, error) {
+	if c.decided {
+		if c.encoder != nil {
+			return c.encoder.Write(data)
+		}
+		return c.ResponseWriter.Write(data)
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.compressible() {
+		c.decide(false)
+		return c.ResponseWriter.Write(data)
+	}
+	c.buffer = append(c.buffer, data...)
+	if len(c.buffer) >= c.minLength {
+		// the content type may be sniffed from the buffer now
+		if err := c.decide(c.compressible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush implement http.Flusher, the response starts streaming with compression
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		if c.decide(c.compressible()) != nil {
+			return
+		}
+	}
+	if c.encoder != nil {
+		_ = c.encoder.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push implement http.Pusher
+func (c *compressWriter) Push(target string, options *http.PushOptions) error {
+	pusher, ok := c.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, options)
+}
+
+// Hijack implement http.Hijacker
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, notHijackerError
+	}
+	return hijacker.Hijack()
+}
+
+func (c *compressWriter) compressible() bool {
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if header.Get(contentType) == "" && len(c.buffer) == 0 {
+		// decide after the content type is sniffed
+		return true
+	}
+	mediaType := header.Get(contentType)
+	if mediaType == "" {
+		mediaType = http.DetectContentType(c.buffer)
+	}
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = parsed
+	}
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == eventStreamContentType {
+		return false
+	}
+	for _, excluded := range c.options.ExcludedTypes {
+		if strings.HasPrefix(mediaType, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// send the header and the buffered body
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	header := c.Header()
+	addVary(header, "Accept-Encoding")
+	if header.Get(contentType) == "" && len(c.buffer) > 0 {
+		header.Set(contentType, http.DetectContentType(c.buffer))
+	}
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", c.encoding)
+		// the representation is changed
+		weakenETag(header)
+		c.encoder = c.pool.Get().(compressEncoder)
+		c.encoder.Reset(c.ResponseWriter)
+	}
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+	buffer := c.buffer
+	c.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if c.encoder != nil {
+		_, err = c.encoder.Write(buffer)
+	} else {
+		_, err = c.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+// close writes the small body without compression and releases the encoder
+func (c *compressWriter) close() {
+	if !c.decided {
+		if c.status == 0 && len(c.buffer) == 0 {
+			// nothing has been written
+			return
+		}
+		_ = c.decide(false)
+	}
+	if c.encoder != nil {
+		_ = c.encoder.Close()
+		c.encoder.Reset(io.Discard)
+		c.pool.Put(c.encoder)
+		c.encoder = nil
+	}
+}
+
+// copied from net/http
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package regia
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressEngine(options ...CompressOptions) *Engine {
+	engine := New()
+	engine.AddInterceptors(CompressInterceptor(options...))
+	engine.GET("/", func(ctx *Context) {
+		_, _ = ctx.Response.Write([]byte(strings.Repeat("regia compress ", 200)))
+	})
+	_ = engine.init()
+	return engine
+}
+
+func TestCompressInterceptor(t *testing.T) {
+	body := strings.Repeat("regia compress ", 200)
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	}
+	engine := compressEngine()
+	for encoding, newReader := range readers {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		if got := recorder.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+		}
+		if recorder.Body.Len() >= len(body) {
+			t.Fatalf("%s: not compressed, %d bytes", encoding, recorder.Body.Len())
+		}
+		reader, err := newReader(recorder.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != body {
+			t.Fatalf("%s: decoded %d bytes, %v", encoding, len(data), err)
+		}
+	}
+}
+
+func TestCompressNoCompressionLevel(t *testing.T) {
+	level := flate.NoCompression
+	engine := compressEngine(CompressOptions{Level: &level})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	// stored blocks are not smaller than the body
+	if recorder.Body.Len() < 3000 {
+		t.Fatalf("compressed to %d bytes with NoCompression", recorder.Body.Len())
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(reader); len(data) != 3000 {
+		t.Fatalf("decoded %d bytes", len(data))
+	}
+}
+
+func TestCompressSkip(t *testing.T) {
+	large := strings.Repeat("regia compress ", 200)
+	png := "\x89PNG\r\n\x1a\n" + large
+	zero := 0
+	tests := []struct {
+		name           string
+		options        CompressOptions
+		method, accept string
+		handle         func(ctx *Context)
+		encoding       string
+		vary           bool
+	}{
+		{"small body", CompressOptions{}, "GET", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.String("small")
+		}, "", true},
+		{"min length 0", CompressOptions{MinLength: &zero}, "GET", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.String("small")
+		}, "gzip", true},
+		{"no accept encoding", CompressOptions{}, "GET", "", func(ctx *Context) {
+			_, _ = ctx.Response.String("%s", large)
+		}, "", true},
+		{"identity only", CompressOptions{}, "GET", "gzip;q=0, identity", func(ctx *Context) {
+			_, _ = ctx.Response.String("%s", large)
+		}, "", true},
+		{"prefer deflate", CompressOptions{}, "GET", "gzip;q=0.5, deflate", func(ctx *Context) {
+			_, _ = ctx.Response.String("%s", large)
+		}, "deflate", true},
+		{"excluded type", CompressOptions{}, "GET", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.Bytes("image/png", []byte(png))
+		}, "", true},
+		{"sniffed excluded type", CompressOptions{}, "GET", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.Write([]byte(png))
+		}, "", true},
+		{"custom excluded type", CompressOptions{ExcludedTypes: []string{"text/"}}, "GET", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.String("%s", large)
+		}, "", true},
+		{"encoded already", CompressOptions{}, "GET", "gzip", func(ctx *Context) {
+			ctx.Response.SetHeader("Content-Encoding", "br")
+			_, _ = ctx.Response.String("%s", large)
+		}, "br", true},
+		{"no content", CompressOptions{}, "GET", "gzip", func(ctx *Context) {
+			ctx.Response.SetStatus(http.StatusNoContent)
+		}, "", true},
+		{"head", CompressOptions{}, "HEAD", "gzip", func(ctx *Context) {
+			_, _ = ctx.Response.String("%s", large)
+		}, "", false},
+	}
+	for _, test := range tests {
+		engine := New()
+		engine.AddInterceptors(CompressInterceptor(test.options))
+		engine.Handle(test.method, "/", test.handle)
+		request := httptest.NewRequest(test.method, "/", nil)
+		if test.accept != "" {
+			request.Header.Set("Accept-Encoding", test.accept)
+		}
+		recorder := serveTest(t, engine, request)
+		header := recorder.Header()
+		if encoding := header.Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("%s: Content-Encoding = %q", test.name, encoding)
+		}
+		if vary := header.Get("Vary") == "Accept-Encoding"; vary != test.vary {
+			t.Errorf("%s: Vary = %q", test.name, header.Get("Vary"))
+		}
+		if test.encoding == "" && test.method != "HEAD" && recorder.Code != http.StatusNoContent && recorder.Body.Len() < 100 && recorder.Body.String() != "small" {
+			t.Errorf("%s: body = %q", test.name, recorder.Body)
+		}
+	}
+}
+
+func TestCompressWeakensETag(t *testing.T) {
+	engine := New()
+	engine.AddInterceptors(CompressInterceptor())
+	engine.GET("/", func(ctx *Context) {
+		ctx.Response.SetHeader("ETag", `"v1"`)
+		_, _ = ctx.Response.String("%s", strings.Repeat("a", 2048))
+	})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := serveTest(t, engine, request)
+	if etag := recorder.Header().Get("ETag"); etag != `W/"v1"` || recorder.Header().Get("Content-Length") != "" {
+		t.Fatalf("ETag = %q, Content-Length = %q", etag, recorder.Header().Get("Content-Length"))
+	}
+}
+
+// Server-Sent Events pass through uncompressed and unbuffered
+func TestCompressSSE(t *testing.T) {
+	engine := New()
+	engine.AddInterceptors(CompressInterceptor())
+	engine.GET("/events", func(ctx *Context) {
+		stream, err := ctx.Response.SSE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = stream.Data("hello")
+	})
+	request := httptest.NewRequest("GET", "/events", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := serveTest(t, engine, request)
+	if recorder.Header().Get("Content-Encoding") != "" || recorder.Body.String() != "data: hello\n\n" || !recorder.Flushed {
+		t.Fatalf("SSE through compression: %v %q", recorder.Header(), recorder.Body)
+	}
+}
@@ -16,6 +16,7 @@ type Context struct {
 	Data     *Data
 	group    HandleFuncGroup
 	index    int
+	route    string
 	Engine   *Engine
 	Request  *Request
 	Response *Response
@@ -27,10 +28,18 @@ func (c *Context) init() {
 }
 
 func (c *Context) start() {
+	defer c.finish()
 	defer c.recover()
 	c.Next()
 }
 
+// stop what the handlers left writing, the writer is invalid after the handlers return
+func (c *Context) finish() {
+	for _, stream := range c.Response.streams {
+		stream.Close()
+	}
+}
+
 func (c *Context) Next() {
 	c.index++
 	for c.index <= len(c.group) {
@@ -54,19 +63,44 @@ func (c *Context) Abort() { c.AbortWith(c.Engine.Abort) }
 
 func (c *Context) AbortWith(exit Exit) { panic(exit) }
 
+// Route returns the pattern of the matched route, such as `/users/:id`,
+// it is empty if no route matched
+func (c *Context) Route() string { return c.route }
+
 // Make http.ResponseWriter as http.Flusher
 func (c *Context) Flusher() http.Flusher { return c.Raw.Writer.(http.Flusher) }
 
-// implement your own idea with it
-func (c *Context) SaveUploadFile(filer *File, path string) error {
-	return c.Engine.FileStorage.Save(filer, path)
+// Session returns the session loaded by SessionMiddleware
+func (c *Context) Session() *Session {
+	session, exist := c.Data.Get(sessionDataKey)
+	if !exist {
+		panic("session middleware is not installed")
+	}
+	return session.(*Session)
+}
+
+// Save the uploaded file with Engine.FileStorage
+// returns the name actually used, it may differ from the given one
+func (c *Context) SaveUploadFile(filer *File, name string) (string, error) {
+	file, err := filer.FileHeader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return c.Engine.FileStorage.Save(name, file)
+}
+
+// SaveUploadPart pipes the streaming part into Engine.FileStorage
+func (c *Context) SaveUploadPart(part *Part, name string) (string, error) {
+	return c.Engine.FileStorage.Save(name, part)
 }
 
 func (c *Context) setWithRaw(req *http.Request, writer http.ResponseWriter, engine *Engine) {
-	c.Raw = &raw{Request: req, Writer: writer}
+	recorder := &responseRecorder{ResponseWriter: writer}
+	c.Raw = &raw{Request: req, Writer: recorder}
 	c.Engine = engine
 	c.Request = &Request{Context: c, Request: req}
-	c.Response = &Response{Context: c, ResponseWriter: writer}
+	c.Response = &Response{Context: c, ResponseWriter: recorder, recorder: recorder}
 }
 
 func newContext(req *http.Request, writer http.ResponseWriter, engine *Engine) *Context {
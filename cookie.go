@@ -0,0 +1,178 @@
+package regia
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	// CookieTamperedError will be returned if the signed or encrypted cookie
+	// can not be verified by any key of the keyring
+	CookieTamperedError = errors.New("cookie has been tampered")
+
+	keyringMissingError = errors.New("engine keyring is not set")
+	emptyKeyringError   = errors.New("keyring needs at least one key")
+)
+
+var cookieEncoding = base64.RawURLEncoding
+
+// Keyring holds the secrets to sign and encrypt cookies.
+// The first key is the primary key which is used to sign and encrypt,
+// all keys are tried to verify and decrypt, so the old keys can be
+// kept for a while after rotation.
+type Keyring struct {
+	keys []cookieKey
+	mu   sync.RWMutex
+}
+
+type cookieKey struct {
+	sign    []byte
+	encrypt cipher.AEAD
+}
+
+func newCookieKey(secret []byte) (cookieKey, error) {
+	derive := func(label string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(label))
+		return mac.Sum(nil)
+	}
+	block, err := aes.NewCipher(derive("regia cookie encrypt"))
+	if err != nil {
+		return cookieKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return cookieKey{}, err
+	}
+	return cookieKey{sign: derive("regia cookie sign"), encrypt: aead}, nil
+}
+
+// Constructor for Keyring, the first secret is the primary one
+func NewKeyring(secrets ...[]byte) (*Keyring, error) {
+	if len(secrets) == 0 {
+		return nil, emptyKeyringError
+	}
+	k := new(Keyring)
+	for _, secret := range secrets {
+		key, err := newCookieKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, key)
+	}
+	return k, nil
+}
+
+// Rotate makes the secret the new primary key
+// and drops the keys beyond `keep` (primary key included)
+func (k *Keyring) Rotate(secret []byte, keep int) error {
+	key, err := newCookieKey(secret)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append([]cookieKey{key}, k.keys...)
+	if keep > 0 && len(k.keys) > keep {
+		k.keys = k.keys[:keep]
+	}
+	return nil
+}
+
+func (k *Keyring) snapshot() []cookieKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys
+}
+
+// the zero value Keyring has no key
+func (k *Keyring) primary() (cookieKey, error) {
+	keys := k.snapshot()
+	if len(keys) == 0 {
+		return cookieKey{}, emptyKeyringError
+	}
+	return keys[0], nil
+}
+
+// Sign returns `value.signature`, the signature is bound to the cookie name
+func (k *Keyring) Sign(name, value string) (string, error) {
+	key, err := k.primary()
+	if err != nil {
+		return "", err
+	}
+	payload := cookieEncoding.EncodeToString([]byte(value))
+	mac := cookieMac(key.sign, name, payload)
+	return payload + "." + cookieEncoding.EncodeToString(mac), nil
+}
+
+// Verify checks the signed value and returns the original one
+func (k *Keyring) Verify(name, signed string) (string, error) {
+	index := strings.LastIndexByte(signed, '.')
+	if index < 0 {
+		return "", CookieTamperedError
+	}
+	payload := signed[:index]
+	signature, err := cookieEncoding.DecodeString(signed[index+1:])
+	if err != nil {
+		return "", CookieTamperedError
+	}
+	for _, key := range k.snapshot() {
+		if hmac.Equal(signature, cookieMac(key.sign, name, payload)) {
+			value, err := cookieEncoding.DecodeString(payload)
+			if err != nil {
+				return "", CookieTamperedError
+			}
+			return string(value), nil
+		}
+	}
+	return "", CookieTamperedError
+}
+
+// Encrypt seals the value with AES-GCM, the cookie name is the additional data
+func (k *Keyring) Encrypt(name, value string) (string, error) {
+	key, err := k.primary()
+	if err != nil {
+		return "", err
+	}
+	aead := key.encrypt
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return cookieEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens the encrypted value and returns the original one
+func (k *Keyring) Decrypt(name, encrypted string) (string, error) {
+	data, err := cookieEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", CookieTamperedError
+	}
+	for _, key := range k.snapshot() {
+		size := key.encrypt.NonceSize()
+		if len(data) < size {
+			return "", CookieTamperedError
+		}
+		if value, err := key.encrypt.Open(nil, data[:size], data[size:], []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", CookieTamperedError
+}
+
+func cookieMac(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,208 @@
+package regia
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, secrets ...string) *Keyring {
+	t.Helper()
+	var keys [][]byte
+	for _, secret := range secrets {
+		keys = append(keys, []byte(secret))
+	}
+	keyring, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+// flip the first character of the part, keeping it valid base64
+func tamper(value string) string {
+	c := byte('A')
+	if value[0] == c {
+		c = 'B'
+	}
+	return string(c) + value[1:]
+}
+
+func TestKeyringSign(t *testing.T) {
+	keyring := newTestKeyring(t, "secret")
+	signed, err := keyring.Sign("user", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := keyring.Verify("user", signed); err != nil || value != "alice" {
+		t.Fatalf("Verify = %q, %v", value, err)
+	}
+
+	index := strings.LastIndexByte(signed, '.')
+	forged, _ := keyring.Sign("user", "bob")
+	for name, value := range map[string]string{
+		"value":        tamper(signed),
+		"signature":    signed[:index+1] + tamper(signed[index+1:]),
+		"swapped":      forged[:strings.LastIndexByte(forged, '.')] + signed[index:],
+		"no signature": signed[:index],
+		"bad base64":   signed + "!",
+		"empty":        "",
+	} {
+		if _, err := keyring.Verify("user", value); err != CookieTamperedError {
+			t.Errorf("%s: Verify = %v", name, err)
+		}
+	}
+	// the signature is bound to the cookie name
+	if _, err := keyring.Verify("admin", signed); err != CookieTamperedError {
+		t.Errorf("Verify with another name = %v", err)
+	}
+	if _, err := newTestKeyring(t, "other").Verify("user", signed); err != CookieTamperedError {
+		t.Errorf("Verify with a wrong key = %v", err)
+	}
+}
+
+func TestKeyringEncrypt(t *testing.T) {
+	keyring := newTestKeyring(t, "secret")
+	encrypted, err := keyring.Encrypt("token", "hidden value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, "hidden") {
+		t.Fatalf("plain text in %q", encrypted)
+	}
+	if again, _ := keyring.Encrypt("token", "hidden value"); again == encrypted {
+		t.Fatal("the nonce is reused")
+	}
+	if value, err := keyring.Decrypt("token", encrypted); err != nil || value != "hidden value" {
+		t.Fatalf("Decrypt = %q, %v", value, err)
+	}
+
+	for name, value := range map[string]string{
+		"tampered":   tamper(encrypted),
+		"truncated":  encrypted[:len(encrypted)-4],
+		"too short":  "AAAA",
+		"bad base64": "!" + encrypted,
+	} {
+		if _, err := keyring.Decrypt("token", value); err != CookieTamperedError {
+			t.Errorf("%s: Decrypt = %v", name, err)
+		}
+	}
+	if _, err := keyring.Decrypt("other", encrypted); err != CookieTamperedError {
+		t.Errorf("Decrypt with another name = %v", err)
+	}
+	if _, err := newTestKeyring(t, "other").Decrypt("token", encrypted); err != CookieTamperedError {
+		t.Errorf("Decrypt with a wrong key = %v", err)
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	keyring := newTestKeyring(t, "old")
+	signed, _ := keyring.Sign("user", "alice")
+	encrypted, _ := keyring.Encrypt("user", "alice")
+
+	if err := keyring.Rotate([]byte("new"), 2); err != nil {
+		t.Fatal(err)
+	}
+	// the old key still verifies, the new one signs
+	if value, err := keyring.Verify("user", signed); err != nil || value != "alice" {
+		t.Fatalf("Verify after rotation = %q, %v", value, err)
+	}
+	if value, err := keyring.Decrypt("user", encrypted); err != nil || value != "alice" {
+		t.Fatalf("Decrypt after rotation = %q, %v", value, err)
+	}
+	resigned, _ := keyring.Sign("user", "alice")
+	if _, err := newTestKeyring(t, "new").Verify("user", resigned); err != nil {
+		t.Fatalf("not signed by the new primary key: %v", err)
+	}
+
+	// the old key is dropped beyond keep
+	if err := keyring.Rotate([]byte("newer"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Verify("user", signed); err != CookieTamperedError {
+		t.Errorf("Verify with a dropped key = %v", err)
+	}
+	if _, err := keyring.Decrypt("user", encrypted); err != CookieTamperedError {
+		t.Errorf("Decrypt with a dropped key = %v", err)
+	}
+	if _, err := keyring.Verify("user", resigned); err != nil {
+		t.Errorf("Verify with the kept key = %v", err)
+	}
+}
+
+func TestKeyringEmpty(t *testing.T) {
+	if _, err := NewKeyring(); err != emptyKeyringError {
+		t.Fatalf("NewKeyring() = %v", err)
+	}
+	var keyring Keyring
+	if _, err := keyring.Sign("user", "alice"); err != emptyKeyringError {
+		t.Errorf("Sign = %v", err)
+	}
+	if _, err := keyring.Encrypt("user", "alice"); err != emptyKeyringError {
+		t.Errorf("Encrypt = %v", err)
+	}
+	if _, err := keyring.Verify("user", "YWxpY2U.c2ln"); err != CookieTamperedError {
+		t.Errorf("Verify = %v", err)
+	}
+	if _, err := keyring.Decrypt("user", "YWxpY2U"); err != CookieTamperedError {
+		t.Errorf("Decrypt = %v", err)
+	}
+}
+
+func TestSignedAndEncryptedCookies(t *testing.T) {
+	engine := New()
+	engine.Keyring = newTestKeyring(t, "secret")
+	engine.GET("/set", func(ctx *Context) {
+		_ = ctx.Response.SetSignedCookie(&http.Cookie{Name: "signed", Value: "alice"})
+		_ = ctx.Response.SetEncryptedCookie(&http.Cookie{Name: "encrypted", Value: "secret"})
+	})
+	engine.GET("/get", func(ctx *Context) {
+		var values []string
+		for _, get := range []func(string) (*http.Cookie, error){ctx.Request.GetSignedCookie, ctx.Request.GetEncryptedCookie} {
+			for _, name := range []string{"signed", "encrypted"} {
+				if cookie, err := get(name); err != nil {
+					values = append(values, err.Error())
+				} else {
+					values = append(values, cookie.Value)
+				}
+			}
+		}
+		_, _ = ctx.Response.String("%s", strings.Join(values, ","))
+	})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/set", nil))
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+
+	get := func(cookies ...*http.Cookie) string {
+		request := httptest.NewRequest(http.MethodGet, "/get", nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+	tampered := CookieTamperedError.Error()
+	// a signed cookie can not be decrypted and the other way round
+	expected := "alice," + tampered + "," + tampered + ",secret"
+	if body := get(cookies...); body != expected {
+		t.Fatalf("got %q, expected %q", body, expected)
+	}
+	forged := &http.Cookie{Name: "signed", Value: tamper(cookies[0].Value)}
+	if body := get(forged, cookies[1]); !strings.HasPrefix(body, tampered+",") {
+		t.Fatalf("forged cookie got %q", body)
+	}
+
+	engine.Keyring = nil
+	if body := get(cookies...); !strings.HasPrefix(body, keyringMissingError.Error()) {
+		t.Fatalf("without keyring got %q", body)
+	}
+}
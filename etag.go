@@ -0,0 +1,205 @@
+package regia
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ETagOptions struct {
+	// Generate the weak ETag `W/"..."`, default strong
+	Weak bool
+
+	// Current returns the ETag and the modification time of the resource for the unsafe methods,
+	// `If-Match` and `If-Unmodified-Since` are checked before the handler runs.
+	// An empty etag or a zero time means unknown.
+	Current func(ctx *Context) (etag string, modTime time.Time)
+}
+
+// ETagMiddleware buffers the response of GET and HEAD to compute the ETag,
+// `304 Not Modified` is responded if `If-None-Match` matched.
+// The unsafe methods get `412 Precondition Failed` if `If-Match` or `If-Unmodified-Since` failed.
+//
+//	branch.Use(regia.ETagMiddleware(regia.ETagOptions{
+//		Current: func(ctx *regia.Context) (string, time.Time) {
+//			article := findArticle(ctx)
+//			return article.Version, article.UpdatedAt
+//		},
+//	}))
+func ETagMiddleware(options ...ETagOptions) HandleFunc {
+	var o ETagOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	return func(ctx *Context) {
+		request := ctx.Raw.Request
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			if isSafeMethod(request.Method) || o.Current == nil || checkPreconditions(ctx, o.Current) {
+				ctx.Next()
+				return
+			}
+			http.Error(ctx.Raw.Writer, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			ctx.Abort()
+			return
+		}
+		writer := &etagWriter{ResponseWriter: ctx.Raw.Writer}
+		rawWriter, responseWriter := ctx.Raw.Writer, ctx.Response.ResponseWriter
+		ctx.Raw.Writer, ctx.Response.ResponseWriter = writer, writer
+		defer func() {
+			ctx.Raw.Writer, ctx.Response.ResponseWriter = rawWriter, responseWriter
+			writer.finish(ctx, o.Weak)
+		}()
+		ctx.Next()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// returns false if the precondition failed
+func checkPreconditions(ctx *Context, current func(ctx *Context) (string, time.Time)) bool {
+	header := ctx.Request.Header()
+	ifMatch := header.Get("If-Match").String()
+	ifUnmodifiedSince, sinceErr := header.IfUnmodifiedSince()
+	if ifMatch == "" && sinceErr != nil {
+		return true
+	}
+	etag, modTime := current(ctx)
+	if ifMatch != "" {
+		return etag != "" && matchETag(ifMatch, etag, false)
+	}
+	return modTime.IsZero() || !modTime.Truncate(time.Second).After(ifUnmodifiedSince)
+}
+
+// matchETag compares the etag with the list of `If-Match` or `If-None-Match`,
+// the weak comparison ignores the `W/` prefix
+func matchETag(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "W/") {
+			if !weak {
+				continue
+			}
+			item = item[2:]
+		}
+		if item == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter buffers the response until the handler returns,
+// it streams the response without ETag after Flush or Hijack
+type etagWriter struct {
+	http.ResponseWriter
+	buffer    []byte
+	status    int
+	streaming bool
+}
+
+func (e *etagWriter) WriteHeader(code int) {
+	if e.streaming || code >= 100 && code < 200 {
+		e.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if e.status == 0 {
+		e.status = code
+	}
+}
+
+func (e *etagWriter) Write(data []byte) (int, error) {
+	if e.streaming {
+		return e.ResponseWriter.Write(data)
+	}
+	if e.status == 0 {
+		e.status = http.StatusOK
+	}
+	e.buffer = append(e.buffer, data...)
+	return len(data), nil
+}
+
+// Flush implement http.Flusher
+func (e *etagWriter) Flush() {
+	e.stream()
+	if flusher, ok := e.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push implement http.Pusher
+func (e *etagWriter) Push(target string, options *http.PushOptions) error {
+	pusher, ok := e.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, options)
+}
+
+// Hijack implement http.Hijacker
+func (e *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := e.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, notHijackerError
+	}
+	e.streaming = true
+	return hijacker.Hijack()
+}
+
+// write the buffered response as it is
+func (e *etagWriter) stream() {
+	if e.streaming {
+		return
+	}
+	e.streaming = true
+	if e.status != 0 {
+		e.ResponseWriter.WriteHeader(e.status)
+	}
+	if len(e.buffer) > 0 {
+		_, _ = e.ResponseWriter.Write(e.buffer)
+	}
+	e.buffer = nil
+}
+
+func (e *etagWriter) finish(ctx *Context, weak bool) {
+	if e.streaming || e.status != http.StatusOK {
+		e.stream()
+		return
+	}
+	header := e.Header()
+	etag := header.Get("ETag")
+	if etag == "" {
+		sum := sha256.Sum256(e.buffer)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if weak {
+			etag = "W/" + etag
+		}
+		header.Set("ETag", etag)
+	}
+	if ifNoneMatch := ctx.Request.Header().Get("If-None-Match").String(); ifNoneMatch != "" && matchETag(ifNoneMatch, etag, true) {
+		// same as net/http
+		header.Del(contentType)
+		header.Del("Content-Length")
+		header.Del("Last-Modified")
+		e.streaming = true
+		e.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	e.stream()
+}
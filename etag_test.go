@@ -0,0 +1,158 @@
+package regia
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		list, etag string
+		weak, want bool
+	}{
+		{`"a"`, `"a"`, false, true},
+		{`"a"`, `"b"`, false, false},
+		{`"b", "a"`, `"a"`, false, true},
+		{`*`, `"a"`, false, true},
+		{`W/"a"`, `"a"`, false, false},
+		{`"a"`, `W/"a"`, false, false},
+		{`W/"a"`, `"a"`, true, true},
+		{`"a"`, `W/"a"`, true, true},
+		{`W/"a"`, `W/"a"`, true, true},
+	}
+	for _, test := range tests {
+		if got := matchETag(test.list, test.etag, test.weak); got != test.want {
+			t.Errorf("matchETag(%q, %q, %v) = %v", test.list, test.etag, test.weak, got)
+		}
+	}
+}
+
+func etagEngine(options ...ETagOptions) *Engine {
+	engine := New()
+	engine.Use(ETagMiddleware(options...))
+	engine.GET("/", func(ctx *Context) {
+		_, _ = ctx.Response.String("%s", strings.Repeat("regia etag ", 200))
+	})
+	engine.GET("/missing", func(ctx *Context) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		_, _ = ctx.Response.String("missing")
+	})
+	engine.GET("/stream", func(ctx *Context) {
+		_, _ = ctx.Response.String("chunk")
+		ctx.Flusher().Flush()
+	})
+	return engine
+}
+
+func serveETag(engine *Engine, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestETagMiddleware(t *testing.T) {
+	engine := etagEngine()
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := serveETag(engine, httptest.NewRequest("GET", "/", nil))
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) || recorder.Body.Len() != 2200 {
+		t.Fatalf("GET = %d, ETag %q, %d bytes", recorder.Code, etag, recorder.Body.Len())
+	}
+	if again := serveETag(engine, httptest.NewRequest("GET", "/", nil)).Header().Get("ETag"); again != etag {
+		t.Fatalf("ETag changed: %q, %q", etag, again)
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("If-None-Match", ifNoneMatch)
+		recorder := serveETag(engine, request)
+		if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get(contentType) != "" || recorder.Header().Get("ETag") != etag {
+			t.Fatalf("If-None-Match %s = %d, %q, %v", ifNoneMatch, recorder.Code, recorder.Body, recorder.Header())
+		}
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("If-None-Match", `"other"`)
+	if recorder := serveETag(engine, request); recorder.Code != http.StatusOK || recorder.Body.Len() != 2200 {
+		t.Fatalf("mismatched If-None-Match = %d", recorder.Code)
+	}
+
+	// only 200 responses get an ETag, streams are written as they are
+	request = httptest.NewRequest("GET", "/missing", nil)
+	request.Header.Set("If-None-Match", "*")
+	if recorder := serveETag(engine, request); recorder.Code != http.StatusNotFound || recorder.Header().Get("ETag") != "" || recorder.Body.String() != "missing" {
+		t.Fatalf("404 = %d, %v", recorder.Code, recorder.Header())
+	}
+	if recorder := serveETag(engine, httptest.NewRequest("GET", "/stream", nil)); recorder.Header().Get("ETag") != "" || recorder.Body.String() != "chunk" || !recorder.Flushed {
+		t.Fatalf("stream = %v, %q", recorder.Header(), recorder.Body)
+	}
+
+	if etag := serveTest(t, etagEngine(ETagOptions{Weak: true}), httptest.NewRequest("GET", "/", nil)).Header().Get("ETag"); !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("weak ETag = %q", etag)
+	}
+}
+
+func TestETagPreconditions(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine := New()
+	engine.Use(ETagMiddleware(ETagOptions{
+		Current: func(ctx *Context) (string, time.Time) { return `"v2"`, modTime },
+	}))
+	engine.PUT("/", func(ctx *Context) { ctx.Response.WriteHeader(http.StatusNoContent) })
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		{"", "", http.StatusNoContent},
+		{"If-Match", `"v2"`, http.StatusNoContent},
+		{"If-Match", `"v1", "v2"`, http.StatusNoContent},
+		{"If-Match", `"v1"`, http.StatusPreconditionFailed},
+		{"If-Match", `W/"v2"`, http.StatusPreconditionFailed},
+		{"If-Match", "*", http.StatusNoContent},
+		{"If-Unmodified-Since", "Mon, 01 Jan 2024 00:00:00 GMT", http.StatusNoContent},
+		{"If-Unmodified-Since", "Sun, 31 Dec 2023 00:00:00 GMT", http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("PUT", "/", nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.value)
+		}
+		if recorder := serveETag(engine, request); recorder.Code != test.want {
+			t.Errorf("%s: %s = %d, want %d", test.header, test.value, recorder.Code, test.want)
+		}
+	}
+}
+
+// the compressed response carries the weak ETag, which is sent back in If-None-Match
+func TestETagCompress(t *testing.T) {
+	engine := etagEngine()
+	engine.AddInterceptors(CompressInterceptor())
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := serveETag(engine, request)
+	etag := recorder.Header().Get("ETag")
+	if recorder.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("compressed = %v", recorder.Header())
+	}
+
+	request = httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	request.Header.Set("If-None-Match", etag)
+	recorder = serveETag(engine, request)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("If-None-Match = %d, %v, %d bytes", recorder.Code, recorder.Header(), recorder.Body.Len())
+	}
+	if recorder.Header().Get("ETag") != etag || !strings.Contains(recorder.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("304 headers = %v", recorder.Header())
+	}
+}
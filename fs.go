@@ -5,7 +5,7 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"strings"
 )
 
 var (
@@ -14,21 +14,85 @@ var (
 		File:  make(map[string][]*multipart.FileHeader),
 	}
 	multipartReaderError = errors.New("http: multipart handled by MultipartReader")
+	multipartParsedError = errors.New("http: multipart handled by ParseMultipartForm")
+	multipartTwiceError  = errors.New("http: MultipartReader called twice")
+
+	// PartTooLargeError will be returned while reading a Part beyond MultipartReader.MaxPartSize
+	PartTooLargeError = errors.New("http: multipart part too large")
 )
 
-type FileStorage interface {
-	Save(filer *File, path string) error
-}
+// MultipartReader hands out the parts of a multipart request one by one
+// without spooling them into memory or temp files
+type MultipartReader struct {
+	reader *multipart.Reader
 
-type FileSystemStorage struct{}
+	// Max size of every part, default 0 means no limit
+	MaxPartSize int64
+
+	// set by UploadPolicy.MultipartReader
+	policy *UploadPolicy
+	files  map[string]int
+}
 
-func (f *FileSystemStorage) Save(filer *File, path string) error {
-	out, err := os.Create(path)
+// NextPart returns the next part, io.EOF will be returned if there is no more part
+func (m *MultipartReader) NextPart() (*Part, error) {
+	part, err := m.reader.NextPart()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	p := &Part{Part: part, source: part, maxSize: m.MaxPartSize, tooLarge: PartTooLargeError}
+	if m.policy != nil && p.IsFile() {
+		if err := m.policy.checkPart(p, m.files); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Part is a streaming part of multipart request
+type Part struct {
+	*multipart.Part
+	// the part or the bytes peeked by UploadPolicy followed by the part
+	source   io.Reader
+	maxSize  int64
+	size     int64
+	tooLarge error
+}
+
+// Read reads the body of the part, PartTooLargeError will be returned
+// if the part is larger than MultipartReader.MaxPartSize,
+// and *UploadError if the file is larger than UploadPolicy.MaxFileSize
+func (p *Part) Read(b []byte) (int, error) {
+	if p.maxSize > 0 {
+		if p.size >= p.maxSize {
+			// probe whether there is more data than the limit
+			var probe [1]byte
+			n, err := p.source.Read(probe[:])
+			if n > 0 {
+				return 0, p.tooLarge
+			}
+			return 0, err
+		}
+		if remain := p.maxSize - p.size; int64(len(b)) > remain {
+			b = b[:remain]
+		}
 	}
-	defer out.Close()
-	return filer.Copy(out)
+	n, err := p.source.Read(b)
+	p.size += int64(n)
+	return n, err
+}
+
+// Size returns the count of bytes have been read
+func (p *Part) Size() int64 { return p.size }
+
+// IsFile reports whether the part is an uploaded file
+func (p *Part) IsFile() bool { return p.FileName() != "" }
+
+// Value reads the whole part as a form value
+func (p *Part) Value() (string, error) {
+	var builder strings.Builder
+	_, err := io.Copy(&builder, p)
+	return builder.String(), err
 }
 
 type Files map[string][]*multipart.FileHeader
@@ -53,7 +117,7 @@ func (f Files) GetAll(key string) ([]*File, error) {
 	if err != nil {
 		return nil, err
 	}
-	fs := make([]*File, len(fhs))
+	fs := make([]*File, 0, len(fhs))
 	for _, f := range fhs {
 		fe := &File{f}
 		fs = append(fs, fe)
@@ -86,8 +150,9 @@ func (f *File) Copy(dst io.Writer) error {
 // os.File impl multipart.File
 func GetFileContentType(file multipart.File) (string, error) {
 	buffer := make([]byte, 512)
-	if _, err := file.Read(buffer); err != nil {
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", err
 	}
-	return http.DetectContentType(buffer), nil
+	return http.DetectContentType(buffer[:n]), nil
 }
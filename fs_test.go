@@ -0,0 +1,122 @@
+package regia
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testPart struct {
+	field, filename, content string
+}
+
+// newMultipartRequest builds a POST request of the parts, a part without filename is a form value
+func newMultipartRequest(path string, parts ...testPart) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range parts {
+		var w io.Writer
+		if part.filename == "" {
+			w, _ = writer.CreateFormField(part.field)
+		} else {
+			w, _ = writer.CreateFormFile(part.field, part.filename)
+		}
+		_, _ = io.WriteString(w, part.content)
+	}
+	_ = writer.Close()
+	request := httptest.NewRequest(http.MethodPost, path, body)
+	request.Header.Set(contentType, writer.FormDataContentType())
+	return request
+}
+
+func serveTest(t *testing.T, engine *Engine, request *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMultipartReader(t *testing.T) {
+	storage := NewMemoryFileStorage()
+	engine := New()
+	engine.FileStorage = storage
+	var results []string
+	engine.POST("/upload", func(ctx *Context) {
+		reader, err := ctx.Request.MultipartReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.MaxPartSize = 5
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !part.IsFile() {
+				value, err := part.Value()
+				results = append(results, part.FormName()+"="+value, errorString(err))
+				continue
+			}
+			// streamed into FileStorage without touching the disk
+			name, err := ctx.SaveUploadPart(part, part.FileName())
+			results = append(results, name, errorString(err))
+		}
+		if _, err := ctx.Request.Files(); err != multipartReaderError {
+			t.Errorf("Files after MultipartReader = %v", err)
+		}
+		if _, err := ctx.Request.MultipartReader(); err != multipartTwiceError {
+			t.Errorf("MultipartReader twice = %v", err)
+		}
+	})
+	serveTest(t, engine, newMultipartRequest("/upload",
+		testPart{field: "title", content: "hello"},
+		testPart{field: "file", filename: "a.txt", content: "12345"},
+		testPart{field: "file", filename: "b.txt", content: "123456"},
+		testPart{field: "title", content: "too long"},
+	))
+
+	expected := []string{"title=hello", "", "a.txt", "", "", PartTooLargeError.Error(), "title=too l", PartTooLargeError.Error()}
+	if strings.Join(results, "|") != strings.Join(expected, "|") {
+		t.Fatalf("results = %q", results)
+	}
+	if content := readStored(t, storage, "a.txt"); content != "12345" {
+		t.Fatalf("a.txt = %q", content)
+	}
+	if _, err := storage.Stat("b.txt"); err == nil {
+		t.Fatal("the part beyond MaxPartSize is stored")
+	}
+}
+
+func TestMultipartReaderAfterFiles(t *testing.T) {
+	engine := New()
+	engine.POST("/upload", func(ctx *Context) {
+		files, err := ctx.Request.Files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file, err := files.Get("file"); err != nil || file.Filename != "a.txt" {
+			t.Errorf("Files.Get = %v, %v", file, err)
+		}
+		if _, err := ctx.Request.MultipartReader(); err != multipartParsedError {
+			t.Errorf("MultipartReader after Files = %v", err)
+		}
+	})
+	serveTest(t, engine, newMultipartRequest("/upload", testPart{field: "file", filename: "a.txt", content: "a"}))
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -1,5 +1,5 @@
 module github.com/eatMoreApple/regia
 
-go 1.14
+go 1.24
 
 
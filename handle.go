@@ -1,15 +1,12 @@
 package regia
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 )
 
 const defaultTimeFormat = "2006-01-02 15:04:05"
 
-var logTitle = formatColor("[REGIA LOG]", colorGreen)
-
 type HandleFunc func(ctx *Context)
 
 type HandleFuncGroup []HandleFunc
@@ -20,18 +17,19 @@ func HandleWithValue(key string, value interface{}) HandleFunc {
 
 func HandleNotFound(ctx *Context) { http.NotFound(ctx.Raw.Writer, ctx.Raw.Request) }
 
+// LogInterceptor logs every request by Engine.Logger
 func LogInterceptor(ctx *Context) {
 	start := time.Now()
 
 	defer func() {
-		endTime := time.Since(start)
-		startTimeStr := formatColor(start.Format(defaultTimeFormat), colorYellow)
-		method := formatColor(fmt.Sprintf("[METHOD:%s]", ctx.Raw.Request.Method), colorBlue)
-		path := formatColor(fmt.Sprintf("[PATH:%s]", ctx.Raw.Request.URL.Path), 96) // #02F3F3
-		addr := formatColor(fmt.Sprintf("[Addr:%s]", ctx.Raw.Request.RemoteAddr), 97)
-		end := formatColor(endTime.String(), colorMagenta)
-		// 2006-01-02 15:04:05     [METHOD:GET]     [Addr:127.0.0.1:49453]      [PATH:/name]
-		fmt.Printf("%-20s %-32s %-20s %-28s %-35s  %-20s\n", logTitle, startTimeStr, end, method, addr, path)
+		ctx.Engine.Logger.Info("request",
+			F("method", ctx.Raw.Request.Method),
+			F("path", ctx.Raw.Request.URL.Path),
+			F("status", ctx.Response.StatusCode()),
+			F("size", ctx.Response.Size()),
+			F("addr", ctx.Raw.Request.RemoteAddr),
+			F("latency", time.Since(start)),
+		)
 	}()
 
 	ctx.Next()
@@ -0,0 +1,317 @@
+package regia
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	emptyHeaderError        = errors.New("empty header")
+	invalidAuthError        = errors.New("invalid authorization header")
+	invalidRangeError       = errors.New("invalid range")
+	unsatisfiableRangeError = errors.New("invalid range: failed to overlap")
+)
+
+// Header is the URLValue-style accessor of http.Header
+// the key will be canonicalized before lookup
+type Header http.Header
+
+func (h Header) Get(key string) Value {
+	return URLValue(h).Get(textproto.CanonicalMIMEHeaderKey(key))
+}
+
+func (h Header) GetAll(key string) Values {
+	return URLValue(h).GetAll(textproto.CanonicalMIMEHeaderKey(key))
+}
+
+func (h Header) GetDefault(key, def string) Value {
+	return URLValue(h).GetDefault(textproto.CanonicalMIMEHeaderKey(key), def)
+}
+
+// Parse `Accept` header
+func (h Header) Accept() AcceptList { return h.acceptList("Accept") }
+
+// Parse `Accept-Encoding` header
+func (h Header) AcceptEncoding() AcceptList { return h.acceptList("Accept-Encoding") }
+
+// Parse `Accept-Language` header
+func (h Header) AcceptLanguage() AcceptList { return h.acceptList("Accept-Language") }
+
+// Parse `Accept-Charset` header
+func (h Header) AcceptCharset() AcceptList { return h.acceptList("Accept-Charset") }
+
+func (h Header) acceptList(key string) AcceptList {
+	var values []string
+	for _, v := range h.GetAll(key) {
+		values = append(values, v.data)
+	}
+	return ParseAccept(strings.Join(values, ","))
+}
+
+// Parse `If-Modified-Since` header
+func (h Header) IfModifiedSince() (time.Time, error) {
+	return h.Get("If-Modified-Since").HttpTime()
+}
+
+// Parse `If-Unmodified-Since` header
+func (h Header) IfUnmodifiedSince() (time.Time, error) {
+	return h.Get("If-Unmodified-Since").HttpTime()
+}
+
+// Parse `Authorization` header
+func (h Header) Authorization() (Authorization, error) {
+	value := h.Get("Authorization")
+	if !value.IsValid() || value.IsEmpty() {
+		return Authorization{}, emptyHeaderError
+	}
+	return ParseAuthorization(value.data)
+}
+
+// Parse `Range` header with the size of the content
+// returns nil if the header is missing
+func (h Header) Range(size int64) ([]HttpRange, error) {
+	value := h.Get("Range")
+	if value.IsEmpty() {
+		return nil, nil
+	}
+	return ParseRange(value.data, size)
+}
+
+// AcceptItem is one element of an Accept like header
+type AcceptItem struct {
+	Value   string
+	Quality float64
+	Params  map[string]string
+}
+
+// AcceptList is sorted by quality, the most preferred comes first
+type AcceptList []AcceptItem
+
+// Parse Accept like header value, such as `text/html, application/json;q=0.9`
+func ParseAccept(header string) AcceptList {
+	var list AcceptList
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ";")
+		item := AcceptItem{Value: strings.ToLower(strings.TrimSpace(fields[0])), Quality: 1}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			var value string
+			if len(kv) == 2 {
+				value = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			if key == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+					item.Quality = q
+				}
+				continue
+			}
+			if item.Params == nil {
+				item.Params = make(map[string]string)
+			}
+			item.Params[key] = value
+		}
+		list = append(list, item)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Quality > list[j].Quality })
+	return list
+}
+
+// Quality returns the quality of the offer, 0 means not acceptable
+// the most specific matched item wins
+func (a AcceptList) Quality(offer string) float64 {
+	offer = strings.ToLower(offer)
+	quality, specificity := 0.0, -1
+	for _, item := range a {
+		if s := acceptMatch(item.Value, offer); s > specificity {
+			quality, specificity = item.Quality, s
+		}
+	}
+	return quality
+}
+
+// Accepts reports whether the offer is acceptable
+func (a AcceptList) Accepts(offer string) bool {
+	return a.Quality(offer) > 0
+}
+
+// Best returns the most acceptable offer
+// the first offer is returned if the list is empty and
+// empty string is returned if nothing is acceptable
+func (a AcceptList) Best(offers ...string) string {
+	if len(a) == 0 {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+	var best string
+	var bestQuality float64
+	for _, offer := range offers {
+		if q := a.Quality(offer); q > bestQuality {
+			best, bestQuality = offer, q
+		}
+	}
+	return best
+}
+
+// returns the specificity of the match, -1 means mismatch
+func acceptMatch(pattern, offer string) int {
+	if pattern == "*" || pattern == "*/*" {
+		return 0
+	}
+	if pattern == offer {
+		return 3
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		if strings.HasPrefix(offer, pattern[:len(pattern)-1]) {
+			return 1
+		}
+		return -1
+	}
+	// language range, `en` matches `en-us`
+	if strings.HasPrefix(offer, pattern+"-") {
+		return 2
+	}
+	return -1
+}
+
+// Authorization is the parsed `Authorization` header
+type Authorization struct {
+	Scheme      string
+	Credentials string
+}
+
+// Parse `Authorization` header value, such as `Bearer token`
+func ParseAuthorization(header string) (Authorization, error) {
+	header = strings.TrimSpace(header)
+	index := strings.IndexByte(header, ' ')
+	if index <= 0 {
+		return Authorization{}, invalidAuthError
+	}
+	auth := Authorization{Scheme: header[:index], Credentials: strings.TrimSpace(header[index+1:])}
+	if auth.Credentials == "" {
+		return Authorization{}, invalidAuthError
+	}
+	return auth, nil
+}
+
+// Is reports whether the scheme equals the given one, case insensitive
+func (a Authorization) Is(scheme string) bool {
+	return strings.EqualFold(a.Scheme, scheme)
+}
+
+// Basic decodes the credentials of `Basic` scheme
+func (a Authorization) Basic() (username, password string, ok bool) {
+	if !a.Is("Basic") {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(a.Credentials)
+	if err != nil {
+		return
+	}
+	pair := string(data)
+	index := strings.IndexByte(pair, ':')
+	if index < 0 {
+		return
+	}
+	return pair[:index], pair[index+1:], true
+}
+
+// Bearer returns the token of `Bearer` scheme
+func (a Authorization) Bearer() (token string, ok bool) {
+	if !a.Is("Bearer") {
+		return
+	}
+	return a.Credentials, true
+}
+
+// HttpRange specifies the byte range to be sent to the client
+type HttpRange struct {
+	Start, Length int64
+}
+
+// ContentRange returns the value of `Content-Range` header
+func (r HttpRange) ContentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.Start, 10) + "-" +
+		strconv.FormatInt(r.Start+r.Length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// Parse `Range` header value, such as `bytes=0-499, -500`
+func ParseRange(header string, size int64) ([]HttpRange, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(header, b) {
+		return nil, invalidRangeError
+	}
+	var ranges []HttpRange
+	noOverlap := false
+	for _, ra := range strings.Split(header[len(b):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		index := strings.IndexByte(ra, '-')
+		if index < 0 {
+			return nil, invalidRangeError
+		}
+		start, end := strings.TrimSpace(ra[:index]), strings.TrimSpace(ra[index+1:])
+		var r HttpRange
+		if start == "" {
+			// suffix range, `-500` means the last 500 bytes
+			i, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || i < 0 {
+				return nil, invalidRangeError
+			}
+			if i == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if i > size {
+				i = size
+			}
+			r.Start = size - i
+			r.Length = size - r.Start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, invalidRangeError
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.Start = i
+			if end == "" {
+				r.Length = size - r.Start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.Start > i {
+					return nil, invalidRangeError
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.Length = i - r.Start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, unsatisfiableRangeError
+		}
+		// `bytes=` without any range
+		return nil, invalidRangeError
+	}
+	return ranges, nil
+}
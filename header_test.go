@@ -0,0 +1,156 @@
+package regia
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	list := ParseAccept(`text/html;level=1, application/json;q=0.9, */*;q=0.1, , text/plain;q=abc, image/png;q=2`)
+	var values []string
+	for _, item := range list {
+		values = append(values, item.Value)
+	}
+	// invalid qualities are ignored, the stable sort keeps the order of equal qualities
+	expected := []string{"text/html", "text/plain", "image/png", "application/json", "*/*"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("ParseAccept = %v", values)
+	}
+	if list[0].Params["level"] != "1" {
+		t.Fatalf("params = %v", list[0].Params)
+	}
+
+	tests := []struct {
+		header, offer string
+		quality       float64
+	}{
+		{"text/html, */*;q=0.1", "text/html", 1},
+		{"text/html, */*;q=0.1", "application/json", 0.1},
+		{"text/*;q=0.5, text/html;q=0.8", "text/html", 0.8},
+		{"text/*;q=0.5, text/html;q=0.8", "text/css", 0.5},
+		{"TEXT/HTML", "text/html", 1},
+		// q=0 excludes the offer even if a wildcard accepts it
+		{"text/html;q=0, */*", "text/html", 0},
+		{"text/html;q=0, */*", "text/plain", 1},
+		{"gzip;q=0", "gzip", 0},
+		{"en", "en-US", 1},
+		{"en-US", "en", 0},
+		{"application/json", "text/html", 0},
+		{"", "text/html", 0},
+	}
+	for _, test := range tests {
+		if q := ParseAccept(test.header).Quality(test.offer); q != test.quality {
+			t.Errorf("Quality(%q) of %q = %v, expected %v", test.offer, test.header, q, test.quality)
+		}
+	}
+
+	if best := ParseAccept("application/xml;q=0.5, application/json").Best("application/xml", "application/json"); best != "application/json" {
+		t.Errorf("Best = %q", best)
+	}
+	if best := ParseAccept("image/png").Best("text/html"); best != "" {
+		t.Errorf("Best of nothing acceptable = %q", best)
+	}
+	if best := ParseAccept("").Best("text/html", "application/json"); best != "text/html" {
+		t.Errorf("Best of empty list = %q", best)
+	}
+}
+
+func TestParseAuthorization(t *testing.T) {
+	tests := []struct {
+		header string
+		auth   Authorization
+		err    error
+	}{
+		{"Bearer token", Authorization{"Bearer", "token"}, nil},
+		{"  Bearer   token  ", Authorization{"Bearer", "token"}, nil},
+		{"Basic dXNlcjpwYXNz", Authorization{"Basic", "dXNlcjpwYXNz"}, nil},
+		{"", Authorization{}, invalidAuthError},
+		{"Bearer", Authorization{}, invalidAuthError},
+		{"Bearer ", Authorization{}, invalidAuthError},
+		{" token", Authorization{}, invalidAuthError},
+	}
+	for _, test := range tests {
+		auth, err := ParseAuthorization(test.header)
+		if auth != test.auth || err != test.err {
+			t.Errorf("ParseAuthorization(%q) = %v, %v", test.header, auth, err)
+		}
+	}
+
+	auth, _ := ParseAuthorization("basic dXNlcjpwOmFzcw==")
+	if user, password, ok := auth.Basic(); !ok || user != "user" || password != "p:ass" {
+		t.Errorf("Basic = %q, %q, %v", user, password, ok)
+	}
+	if _, ok := auth.Bearer(); ok {
+		t.Error("Bearer of a Basic authorization")
+	}
+	for _, header := range []string{"Basic !!!", "Basic dXNlcg==", "Bearer dXNlcjpwYXNz"} {
+		auth, _ := ParseAuthorization(header)
+		if _, _, ok := auth.Basic(); ok {
+			t.Errorf("Basic of %q is ok", header)
+		}
+	}
+
+	if _, err := (Header{}).Authorization(); err != emptyHeaderError {
+		t.Errorf("missing Authorization = %v", err)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		ranges []HttpRange
+		err    error
+	}{
+		{"bytes=0-499", 1000, []HttpRange{{0, 500}}, nil},
+		{"bytes=500-", 1000, []HttpRange{{500, 500}}, nil},
+		{"bytes=0-0, -1", 1000, []HttpRange{{0, 1}, {999, 1}}, nil},
+		{"bytes= 0 - 9 ,", 1000, []HttpRange{{0, 10}}, nil},
+		// the end past the size is cut
+		{"bytes=900-2000", 1000, []HttpRange{{900, 100}}, nil},
+		// suffix ranges past the start return the whole content
+		{"bytes=-500", 1000, []HttpRange{{500, 500}}, nil},
+		{"bytes=-2000", 1000, []HttpRange{{0, 1000}}, nil},
+		// the ranges failed to overlap are dropped if others overlap
+		{"bytes=2000-, 0-9", 1000, []HttpRange{{0, 10}}, nil},
+		{"bytes=-0", 1000, nil, unsatisfiableRangeError},
+		{"bytes=1000-", 1000, nil, unsatisfiableRangeError},
+		{"bytes=-10", 0, nil, unsatisfiableRangeError},
+		{"bytes=0-9", 0, nil, unsatisfiableRangeError},
+		{"bytes=", 1000, nil, invalidRangeError},
+		{"bytes=10-0", 1000, nil, invalidRangeError},
+		{"bytes=a-9", 1000, nil, invalidRangeError},
+		{"bytes=0-b", 1000, nil, invalidRangeError},
+		{"bytes=--1", 1000, nil, invalidRangeError},
+		{"bytes=10", 1000, nil, invalidRangeError},
+		{"items=0-9", 1000, nil, invalidRangeError},
+	}
+	for _, test := range tests {
+		ranges, err := ParseRange(test.header, test.size)
+		if !reflect.DeepEqual(ranges, test.ranges) || err != test.err {
+			t.Errorf("ParseRange(%q, %d) = %v, %v", test.header, test.size, ranges, err)
+		}
+	}
+
+	if r := (HttpRange{Start: 500, Length: 500}).ContentRange(1000); r != "bytes 500-999/1000" {
+		t.Errorf("ContentRange = %q", r)
+	}
+	if ranges, err := (Header{}).Range(1000); ranges != nil || err != nil {
+		t.Errorf("missing Range = %v, %v", ranges, err)
+	}
+}
+
+func TestRequestHeaderAndCookies(t *testing.T) {
+	raw, _ := http.NewRequest(http.MethodGet, "/", nil)
+	raw.Header.Set("X-Tenant", "a")
+	raw.Header.Add("Cookie", "name=a; name=b; other=c")
+	r := &Request{Request: raw}
+	if tenant := r.Header().Get("x-tenant").String(); tenant != "a" {
+		t.Errorf("Header().Get = %q", tenant)
+	}
+	cookies := r.Cookies()
+	if !reflect.DeepEqual(cookies["name"], []string{"a", "b"}) || cookies.Get("other").String() != "c" {
+		t.Errorf("Cookies = %v", cookies)
+	}
+}
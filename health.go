@@ -0,0 +1,203 @@
+package regia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLivenessPath       = "/healthz"
+	defaultReadinessPath      = "/readyz"
+	defaultHealthCheckTimeout = 5 * time.Second
+
+	healthUp   = "up"
+	healthDown = "down"
+	healthWarn = "warn"
+)
+
+var shuttingDownError = errors.New("shutting down")
+
+// HealthCheck is a named check of a component, such as database or cache
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+
+	// Timeout of the check, default 5 seconds
+	Timeout time.Duration
+
+	// The readiness fails if a critical check fails,
+	// the failure of other checks is reported as `warn`
+	Critical bool
+
+	// Run the check in liveness too, it should only check the process itself
+	Liveness bool
+}
+
+// HealthResult is the result of a check in the response
+type HealthResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the response of liveness and readiness
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks,omitempty"`
+}
+
+// Health serves the liveness and readiness routes with the registered checks.
+// Register it with Engine.AddStarter, the routes are added before the routes registered,
+// and the readiness fails as soon as the graceful shutdown begins.
+//
+//	health := regia.NewHealth()
+//	health.AddCheck(regia.HealthCheck{Name: "db", Check: db.PingContext, Critical: true})
+//	engine.AddStarter(health)
+type Health struct {
+	// default `/healthz`
+	LivenessPath string
+
+	// default `/readyz`
+	ReadinessPath string
+
+	// Time to keep serving after the readiness fails while shutting down,
+	// so the load balancer can remove the instance before the server stops accepting
+	DrainDelay time.Duration
+
+	// Middlewares of the routes
+	Group HandleFuncGroup
+
+	checks       []HealthCheck
+	shuttingDown int32
+	mu           sync.RWMutex
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// AddCheck registers the check, the name should be unique
+func (h *Health) AddCheck(checks ...HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, checks...)
+}
+
+// Phase implement PhaseStarter
+func (h *Health) Phase() StartPhase { return BeforeRoutes }
+
+// Start implement Starter, it registers the routes and the shutdown hook
+func (h *Health) Start(engine *Engine) error {
+	liveness, readiness := h.LivenessPath, h.ReadinessPath
+	if liveness == "" {
+		liveness = defaultLivenessPath
+	}
+	if readiness == "" {
+		readiness = defaultReadinessPath
+	}
+	engine.GET(liveness, append(h.Group, h.Liveness)...)
+	engine.GET(readiness, append(h.Group, h.Readiness)...)
+	engine.OnShutdown(h.shutdown)
+	return nil
+}
+
+func (h *Health) shutdown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+	if h.DrainDelay > 0 {
+		time.Sleep(h.DrainDelay)
+	}
+}
+
+// Liveness responds whether the process is alive
+func (h *Health) Liveness(ctx *Context) {
+	h.respond(ctx, h.Report(ctx.Raw.Request.Context(), true))
+}
+
+// Readiness responds whether the service can accept requests
+func (h *Health) Readiness(ctx *Context) {
+	h.respond(ctx, h.Report(ctx.Raw.Request.Context(), false))
+}
+
+func (h *Health) respond(ctx *Context, report HealthReport) {
+	status := http.StatusOK
+	if report.Status == healthDown {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.Response.SetHeader("Cache-Control", "no-store")
+	_ = ctx.Response.Status(status).Json(report)
+}
+
+// Report runs the checks concurrently, only the liveness checks are run if liveness is true
+func (h *Health) Report(ctx context.Context, liveness bool) HealthReport {
+	h.mu.RLock()
+	checks := make([]HealthCheck, 0, len(h.checks))
+	for _, check := range h.checks {
+		if !liveness || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: healthUp, Checks: make(map[string]HealthResult, len(checks))}
+	results := make([]HealthResult, len(checks))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+	for i, check := range checks {
+		result := results[i]
+		if result.Status != healthUp {
+			if check.Critical {
+				report.Status = healthDown
+			} else {
+				result.Status = healthWarn
+			}
+		}
+		report.Checks[check.Name] = result
+	}
+	if !liveness && atomic.LoadInt32(&h.shuttingDown) == 1 {
+		report.Status = healthDown
+		report.Checks["shutdown"] = HealthResult{Status: healthDown, Duration: "0s", Error: shuttingDownError.Error()}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) (result HealthResult) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				errs <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+		errs <- check.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result = HealthResult{Status: healthUp, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status, result.Error = healthDown, err.Error()
+	}
+	return result
+}
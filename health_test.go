@@ -0,0 +1,154 @@
+package regia
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getHealth(t *testing.T, engine *Engine, path string) (int, HealthReport) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	if recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("%s: Cache-Control = %q", path, recorder.Header().Get("Cache-Control"))
+	}
+	var report HealthReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("%s: %v, %q", path, err, recorder.Body)
+	}
+	return recorder.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	var dbDown bool
+	health := NewHealth()
+	health.AddCheck(
+		HealthCheck{Name: "db", Critical: true, Check: func(context.Context) error {
+			if dbDown {
+				return dbErr
+			}
+			return nil
+		}},
+		HealthCheck{Name: "cache", Check: func(context.Context) error { return errors.New("miss") }},
+		HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		}},
+		HealthCheck{Name: "panic", Check: func(context.Context) error { panic("oops") }},
+		HealthCheck{Name: "goroutines", Liveness: true, Check: func(context.Context) error { return nil }},
+	)
+	engine := New()
+	engine.AddStarter(health)
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, report := getHealth(t, engine, "/readyz")
+	if status != http.StatusOK || report.Status != healthUp || len(report.Checks) != 5 {
+		t.Fatalf("readiness = %d, %+v", status, report)
+	}
+	want := map[string]HealthResult{
+		"db":         {Status: healthUp},
+		"cache":      {Status: healthWarn, Error: "miss"},
+		"slow":       {Status: healthWarn, Error: context.DeadlineExceeded.Error()},
+		"panic":      {Status: healthWarn, Error: "panic: oops"},
+		"goroutines": {Status: healthUp},
+	}
+	for name, result := range want {
+		got := report.Checks[name]
+		if got.Status != result.Status || got.Error != result.Error || got.Duration == "" {
+			t.Errorf("check %s = %+v, want %+v", name, got, result)
+		}
+	}
+	if d, _ := time.ParseDuration(report.Checks["slow"].Duration); d >= time.Second {
+		t.Errorf("slow check took %s, the timeout is 10ms", d)
+	}
+
+	// only the liveness checks run in liveness
+	status, report = getHealth(t, engine, "/healthz")
+	if status != http.StatusOK || len(report.Checks) != 1 || report.Checks["goroutines"].Status != healthUp {
+		t.Fatalf("liveness = %d, %+v", status, report)
+	}
+
+	dbDown = true
+	status, report = getHealth(t, engine, "/readyz")
+	if status != http.StatusServiceUnavailable || report.Status != healthDown || report.Checks["db"].Error != dbErr.Error() {
+		t.Fatalf("critical failure = %d, %+v", status, report)
+	}
+	if status, _ := getHealth(t, engine, "/healthz"); status != http.StatusOK {
+		t.Fatalf("liveness with db down = %d", status)
+	}
+}
+
+func TestHealthPaths(t *testing.T) {
+	var called bool
+	health := NewHealth()
+	health.LivenessPath, health.ReadinessPath = "/live", "/ready"
+	health.Group = HandleFuncGroup{func(ctx *Context) {
+		called = true
+		ctx.Next()
+	}}
+	engine := New()
+	engine.AddStarter(health)
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	if status, report := getHealth(t, engine, "/live"); status != http.StatusOK || report.Status != healthUp || !called {
+		t.Fatalf("/live = %d, %+v, middleware called %v", status, report, called)
+	}
+	if status, _ := getHealth(t, engine, "/ready"); status != http.StatusOK {
+		t.Fatalf("/ready = %d", status)
+	}
+}
+
+// the readiness fails as soon as the shutdown begins, the requests are served during DrainDelay
+func TestHealthShutdown(t *testing.T) {
+	health := NewHealth()
+	health.DrainDelay = 500 * time.Millisecond
+	engine := New()
+	engine.AddStarter(health)
+	base := runEngine(t, engine)
+	// a connection per request, so no unused connection delays the shutdown
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	readiness := func() int {
+		resp, err := client.Get(base + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := readiness(); status != http.StatusOK {
+		t.Fatalf("readiness before shutdown = %d", status)
+	}
+	engine.Shutdown()
+	deadline := time.Now().Add(health.DrainDelay / 2)
+	for readiness() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness did not fail after the shutdown began")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var report HealthReport
+	resp, err := client.Get(base + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil || report.Checks["shutdown"].Error != shuttingDownError.Error() {
+		t.Fatalf("report = %+v, %v", report, err)
+	}
+	if resp, err := client.Get(base + "/healthz"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("liveness while draining = %v", err)
+	} else {
+		_ = resp.Body.Close()
+	}
+}
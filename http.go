@@ -1,17 +1,23 @@
 package regia
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 )
 
 const (
-	contentType         = "Content-Type"
-	jsonContentType     = "application/json;charset=utf-8"
-	textHtmlContentType = "text/html;charset=utf-8"
-	textXmlContentType  = "text/xml;charset=utf-8"
+	contentType           = "Content-Type"
+	jsonContentType       = "application/json;charset=utf-8"
+	textHtmlContentType   = "text/html;charset=utf-8"
+	textXmlContentType    = "text/xml;charset=utf-8"
+	xmlContentType        = "application/xml;charset=utf-8"
+	textPlainContentType  = "text/plain;charset=utf-8"
+	javascriptContentType = "application/javascript;charset=utf-8"
 )
 
 const (
@@ -68,6 +74,21 @@ func (r *Request) Form() URLValue {
 	return URLValue(r.Request.PostForm)
 }
 
+// Header returns the request header, it shadows the field of *http.Request
+// use r.Request.Header to get the raw one
+func (r *Request) Header() Header {
+	return Header(r.Request.Header)
+}
+
+// Cookies returns all cookies' values keyed by their name
+func (r *Request) Cookies() URLValue {
+	cookies := make(URLValue)
+	for _, cookie := range r.Request.Cookies() {
+		cookies[cookie.Name] = append(cookies[cookie.Name], cookie.Value)
+	}
+	return cookies
+}
+
 func (r *Request) Files() (Files, error) {
 	req := r.Request
 	if req.MultipartForm == multipartByReader {
@@ -84,6 +105,24 @@ func (r *Request) Files() (Files, error) {
 	return nil, http.ErrMissingFile
 }
 
+// MultipartReader returns a reader to process the multipart request as a stream.
+// Files can not be used after calling it and vice versa.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	req := r.Request
+	if req.MultipartForm == multipartByReader {
+		return nil, multipartTwiceError
+	}
+	if req.MultipartForm != nil {
+		return nil, multipartParsedError
+	}
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	req.MultipartForm = multipartByReader
+	return &MultipartReader{reader: reader}, nil
+}
+
 func (r *Request) Scan(scanner Scanner, v interface{}) error {
 	return scanner.Scan(r.Context.Raw.Request, v)
 }
@@ -102,11 +141,56 @@ func (r *Request) GetCookie(key string) (*http.Cookie, error) {
 	return r.Request.Cookie(key)
 }
 
+// GetSignedCookie returns the cookie set by Response.SetSignedCookie
+// CookieTamperedError will be returned if the signature mismatched
+func (r *Request) GetSignedCookie(key string) (*http.Cookie, error) {
+	return r.getCookieWith(key, func(keyring *Keyring, value string) (string, error) {
+		return keyring.Verify(key, value)
+	})
+}
+
+// GetEncryptedCookie returns the cookie set by Response.SetEncryptedCookie
+// CookieTamperedError will be returned if it can not be decrypted
+func (r *Request) GetEncryptedCookie(key string) (*http.Cookie, error) {
+	return r.getCookieWith(key, func(keyring *Keyring, value string) (string, error) {
+		return keyring.Decrypt(key, value)
+	})
+}
+
+func (r *Request) getCookieWith(key string, decode func(keyring *Keyring, value string) (string, error)) (*http.Cookie, error) {
+	keyring := r.Context.Engine.Keyring
+	if keyring == nil {
+		return nil, keyringMissingError
+	}
+	cookie, err := r.Request.Cookie(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decode(keyring, cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+	c := *cookie
+	c.Value = value
+	return &c, nil
+}
+
 type Response struct {
 	Context *Context
 	http.ResponseWriter
+	status   int
+	recorder *responseRecorder
+
+	// closed after the handlers return
+	streams []*SSEStream
 }
 
+// StatusCode returns the status sent to the client, 0 if nothing has been sent
+func (r *Response) StatusCode() int { return r.recorder.status }
+
+// Size returns the count of bytes of the body sent to the client
+func (r *Response) Size() int64 { return r.recorder.size }
+
 func (r *Response) SetStatus(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
@@ -119,8 +203,65 @@ func (r *Response) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(r.ResponseWriter, cookie)
 }
 
+// SetSignedCookie signs the cookie value with Engine.Keyring
+// the value is readable by the client but can not be modified
+func (r *Response) SetSignedCookie(cookie *http.Cookie) error {
+	keyring := r.Context.Engine.Keyring
+	if keyring == nil {
+		return keyringMissingError
+	}
+	value, err := keyring.Sign(cookie.Name, cookie.Value)
+	if err != nil {
+		return err
+	}
+	c := *cookie
+	c.Value = value
+	r.SetCookie(&c)
+	return nil
+}
+
+// SetEncryptedCookie encrypts the cookie value with Engine.Keyring
+func (r *Response) SetEncryptedCookie(cookie *http.Cookie) error {
+	keyring := r.Context.Engine.Keyring
+	if keyring == nil {
+		return keyringMissingError
+	}
+	value, err := keyring.Encrypt(cookie.Name, cookie.Value)
+	if err != nil {
+		return err
+	}
+	c := *cookie
+	c.Value = value
+	r.SetCookie(&c)
+	return nil
+}
+
+// Status sets the status for the next render, such as `Response.Status(201).Json(v)`
+// Content-Type will be set before the status is sent
+func (r *Response) Status(code int) *Response {
+	r.status = code
+	return r
+}
+
 func (r *Response) Render(render Render, data interface{}) error {
-	return render.Render(r.ResponseWriter, data)
+	return r.renderStatus(r.status, render, data)
+}
+
+// render with the status, WriteHeader is delayed until the first write,
+// so the render can set Content-Type before the status is sent
+func (r *Response) renderStatus(status int, render Render, data interface{}) error {
+	writer := r.statusWriter(status)
+	if err := render.Render(writer, data); err != nil {
+		return err
+	}
+	writer.flushStatus()
+	return nil
+}
+
+// statusWriter consumes the status set by Response.Status
+func (r *Response) statusWriter(status int) *statusWriter {
+	r.status = 0
+	return &statusWriter{ResponseWriter: r.ResponseWriter, status: status}
 }
 
 func (r *Response) Json(data interface{}) error {
@@ -128,10 +269,28 @@ func (r *Response) Json(data interface{}) error {
 	return r.Render(render, data)
 }
 
+// PrettyJson writes the indented json
+func (r *Response) PrettyJson(data interface{}) error {
+	render := JsonRender{Serializer: r.Context.Engine.JsonSerializer, Indent: "  "}
+	return r.Render(render, data)
+}
+
+// Jsonp wraps the json with the callback, such as `callback({"a":1});`
+func (r *Response) Jsonp(callback string, data interface{}) error {
+	render := JsonpRender{Serializer: r.Context.Engine.JsonSerializer, Callback: callback}
+	return r.Render(render, data)
+}
+
 func (r *Response) String(format string, a ...interface{}) (int, error) {
 	text := fmt.Sprintf(format, a...)
-	writeContentType(r.Context.Raw.Writer, textHtmlContentType)
-	return r.Context.Raw.Writer.Write([]byte(text))
+	return r.Bytes(textHtmlContentType, []byte(text))
+}
+
+// Bytes writes the raw data with the content type
+func (r *Response) Bytes(contentType string, data []byte) (int, error) {
+	writer := r.statusWriter(r.status)
+	writeContentType(writer, contentType)
+	return writer.Write(data)
 }
 
 func (r *Response) Xml(data interface{}) error {
@@ -140,7 +299,26 @@ func (r *Response) Xml(data interface{}) error {
 }
 
 func (r *Response) Html(name string, data interface{}) error {
-	return r.Context.Engine.HtmlRender.Render(r.Context.Raw.Writer, name, data)
+	writer := r.statusWriter(r.status)
+	if err := r.Context.Engine.HtmlRender.Render(writer, name, data); err != nil {
+		return err
+	}
+	writer.flushStatus()
+	return nil
+}
+
+// Push initiates an HTTP/2 server push of the target,
+// http.ErrNotSupported is returned if the connection does not support it
+func (r *Response) Push(target string, options ...*http.PushOptions) error {
+	pusher, ok := r.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	var opts *http.PushOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	return pusher.Push(target, opts)
 }
 
 // Shortcut for http.Redirect
@@ -158,6 +336,133 @@ func (r *Response) ServeContent(name string, modTime time.Time, content io.ReadS
 	http.ServeContent(r.ResponseWriter, r.Context.Raw.Request, name, modTime, content)
 }
 
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	s.status = code
+	s.flushStatus()
+}
+
+func (s *statusWriter) Write(data []byte) (int, error) {
+	s.flushStatus()
+	return s.ResponseWriter.Write(data)
+}
+
+func (s *statusWriter) flushStatus() {
+	if !s.wrote && s.status != 0 {
+		s.ResponseWriter.WriteHeader(s.status)
+	}
+	s.wrote = true
+}
+
+// responseRecorder records the status and the size of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 && code >= 200 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.size += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the sendfile optimization of http.ServeContent
+func (r *responseRecorder) ReadFrom(reader io.Reader) (int64, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if readerFrom, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(reader)
+	} else {
+		n, err = io.Copy(r.ResponseWriter, reader)
+	}
+	r.size += n
+	return n, err
+}
+
+// Flush implement http.Flusher
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implement http.Hijacker
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, notHijackerError
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Push implement http.Pusher
+func (r *responseRecorder) Push(target string, options *http.PushOptions) error {
+	pusher, ok := r.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, options)
+}
+
+// Unwrap is used by http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// returned by Hijack of the writers of regia if the wrapped writer can not be hijacked, such as over HTTP/2
+var notHijackerError = errors.New("http: response does not implement http.Hijacker")
+
+// the writers of regia implement http.Flusher and http.Hijacker whether the wrapped one supports them or not,
+// canFlush and canHijack check the raw writer under them
+func rawWriter(writer http.ResponseWriter) http.ResponseWriter {
+	for {
+		switch w := writer.(type) {
+		case *responseRecorder:
+			writer = w.ResponseWriter
+		case *compressWriter:
+			writer = w.ResponseWriter
+		case *etagWriter:
+			writer = w.ResponseWriter
+		default:
+			return writer
+		}
+	}
+}
+
+func canFlush(writer http.ResponseWriter) bool {
+	_, ok := rawWriter(writer).(http.Flusher)
+	return ok
+}
+
+func canHijack(writer http.ResponseWriter) bool {
+	_, ok := rawWriter(writer).(http.Hijacker)
+	return ok
+}
+
 func writeContentType(writer http.ResponseWriter, cT string) {
 	writer.Header().Del(contentType)
 	writer.Header().Set(contentType, cT)
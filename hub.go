@@ -0,0 +1,428 @@
+package regia
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHubQueueSize    = 64
+	defaultHubWriteTimeout = 10 * time.Second
+	defaultHubPingInterval = 30 * time.Second
+)
+
+var (
+	hubNotRunningError = errors.New("hub is not running")
+
+	// HubQueueFullError will be returned if the send queue of the connection is full
+	HubQueueFullError = errors.New("hub: send queue is full")
+
+	// HubClientClosedError will be returned while sending to a closed connection
+	HubClientClosedError = errors.New("hub: client is closed")
+)
+
+// HubMessage is a message queued to send
+type HubMessage struct {
+	Type int
+	Data []byte
+}
+
+// HubClient is a WebSocket connection managed by Hub
+type HubClient struct {
+	// ID is unique in the Hub
+	ID string
+
+	// User is the value stored in Context.Data by Hub.UserKey
+	User string
+
+	Conn *WebSocketConn
+
+	// Data of the Context which upgraded the connection
+	Data *Data
+
+	hub       *Hub
+	send      chan HubMessage
+	rooms     map[string]struct{}
+	closed    chan struct{}
+	stopped   chan struct{}
+	closeCode int
+	closeText string
+	once      sync.Once
+}
+
+// Send queues the message without blocking
+func (c *HubClient) Send(messageType int, data []byte) error {
+	select {
+	case <-c.closed:
+		return HubClientClosedError
+	default:
+	}
+	select {
+	case c.send <- HubMessage{Type: messageType, Data: data}:
+		return nil
+	default:
+		if !c.hub.DropOnFull {
+			// the client is too slow, disconnect it to protect the others,
+			// the write stuck on it is interrupted
+			c.close(ClosePolicyViolation, "send queue overflow")
+			_ = c.Conn.SetWriteDeadline(time.Now())
+		}
+		return HubQueueFullError
+	}
+}
+
+// Join the room
+func (c *HubClient) Join(room string) { c.hub.Join(c, room) }
+
+// Leave the room
+func (c *HubClient) Leave(room string) { c.hub.Leave(c, room) }
+
+// Close disconnects the client
+func (c *HubClient) Close() { c.close(CloseNormalClosure, "") }
+
+// close only signals writePump, so the caller never waits for a slow peer
+func (c *HubClient) close(code int, text string) {
+	c.once.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.closed)
+	})
+}
+
+// write the queued messages until the client is closed,
+// then send the close frame and close the connection
+func (c *HubClient) writePump() {
+	defer close(c.stopped)
+	for {
+		select {
+		case <-c.closed:
+			_ = c.Conn.WriteControl(CloseMessage, FormatCloseMessage(c.closeCode, c.closeText), time.Now().Add(time.Second))
+			_ = c.Conn.Close()
+			return
+		case message := <-c.send:
+			select {
+			case <-c.closed:
+				continue
+			default:
+			}
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(c.hub.writeTimeout()))
+			if err := c.Conn.WriteMessage(message.Type, message.Data); err != nil {
+				c.close(CloseInternalServerErr, "")
+			}
+		}
+	}
+}
+
+// Hub manages the WebSocket connections by rooms and users.
+// Register it with Engine.AddStarter and Engine.AddStopper, then serve connections with Hub.Serve.
+//
+//	hub := regia.NewHub()
+//	hub.UserKey = "user"
+//	engine.AddStarter(hub)
+//	engine.AddStopper(hub)
+//	engine.GET("/ws", auth, func(ctx *regia.Context) { hub.Serve(ctx) })
+type Hub struct {
+	// Key of Context.Data to find the user of the connection
+	UserKey string
+
+	// Size of the send queue of every connection, default 64
+	QueueSize int
+
+	// Drop the message if the queue is full, default false means disconnect the slow client
+	DropOnFull bool
+
+	// Timeout of writing a message, default 10 seconds
+	WriteTimeout time.Duration
+
+	// Interval to ping all connections, default 30 seconds
+	PingInterval time.Duration
+
+	// OnMessage will be called for every message received
+	OnMessage func(client *HubClient, messageType int, data []byte)
+
+	// OnLeave will be called after the client disconnected
+	OnLeave func(client *HubClient)
+
+	clients map[string]*HubClient
+	users   map[string]map[*HubClient]struct{}
+	rooms   map[string]map[*HubClient]struct{}
+	done    chan struct{}
+	mu      sync.RWMutex
+}
+
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+// Start implement Starter
+func (h *Hub) Start(engine *Engine) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done != nil {
+		return nil
+	}
+	h.clients = make(map[string]*HubClient)
+	h.users = make(map[string]map[*HubClient]struct{})
+	h.rooms = make(map[string]map[*HubClient]struct{})
+	h.done = make(chan struct{})
+	go h.ping(h.done)
+	return nil
+}
+
+// Stop implement Stopper
+func (h *Hub) Stop(engine *Engine) { h.Close() }
+
+// Close disconnects all clients and stops the hub
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if h.done == nil {
+		h.mu.Unlock()
+		return
+	}
+	close(h.done)
+	h.done = nil
+	clients := make([]*HubClient, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+	for _, client := range clients {
+		client.close(CloseGoingAway, "server shutdown")
+	}
+	// wait for the close frames sent
+	for _, client := range clients {
+		<-client.stopped
+	}
+}
+
+func (h *Hub) ping(done chan struct{}) {
+	interval := h.PingInterval
+	if interval <= 0 {
+		interval = defaultHubPingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// do not hold the lock while writing to the peers
+			h.mu.RLock()
+			clients := make([]*HubClient, 0, len(h.clients))
+			for _, client := range h.clients {
+				clients = append(clients, client)
+			}
+			h.mu.RUnlock()
+			for _, client := range clients {
+				_ = client.Conn.WriteControl(PingMessage, nil, time.Now().Add(h.writeTimeout()))
+			}
+		}
+	}
+}
+
+func (h *Hub) writeTimeout() time.Duration {
+	if h.WriteTimeout > 0 {
+		return h.WriteTimeout
+	}
+	return defaultHubWriteTimeout
+}
+
+// Serve upgrades the request and reads messages until the connection closed
+func (h *Hub) Serve(ctx *Context, options ...UpgradeOptions) error {
+	h.mu.RLock()
+	running := h.done != nil
+	h.mu.RUnlock()
+	if !running {
+		return hubNotRunningError
+	}
+	conn, err := ctx.Upgrade(options...)
+	if err != nil {
+		return err
+	}
+	size := h.QueueSize
+	if size <= 0 {
+		size = defaultHubQueueSize
+	}
+	client := &HubClient{
+		ID:      randomHex(12),
+		Conn:    conn,
+		Data:    ctx.Data,
+		hub:     h,
+		send:    make(chan HubMessage, size),
+		rooms:   make(map[string]struct{}),
+		closed:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if h.UserKey != "" {
+		if user, exist := ctx.Data.Get(h.UserKey); exist {
+			client.User = fmt.Sprint(user)
+		}
+	}
+	go client.writePump()
+	if !h.register(client) {
+		client.close(CloseGoingAway, "server shutdown")
+		return hubNotRunningError
+	}
+	defer h.unregister(client)
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			client.close(CloseNormalClosure, "")
+			if _, ok := err.(*CloseError); ok {
+				return nil
+			}
+			return err
+		}
+		if h.OnMessage != nil {
+			h.OnMessage(client, messageType, data)
+		}
+	}
+}
+
+func (h *Hub) register(client *HubClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done == nil {
+		return false
+	}
+	h.clients[client.ID] = client
+	if client.User != "" {
+		if h.users[client.User] == nil {
+			h.users[client.User] = make(map[*HubClient]struct{})
+		}
+		h.users[client.User][client] = struct{}{}
+	}
+	return true
+}
+
+func (h *Hub) unregister(client *HubClient) {
+	h.mu.Lock()
+	delete(h.clients, client.ID)
+	if client.User != "" {
+		delete(h.users[client.User], client)
+		if len(h.users[client.User]) == 0 {
+			delete(h.users, client.User)
+		}
+	}
+	for room := range client.rooms {
+		h.leave(client, room)
+	}
+	h.mu.Unlock()
+	if h.OnLeave != nil {
+		h.OnLeave(client)
+	}
+}
+
+// Join adds the client to the room
+func (h *Hub) Join(client *HubClient, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exist := h.clients[client.ID]; !exist {
+		return
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*HubClient]struct{})
+	}
+	h.rooms[room][client] = struct{}{}
+	client.rooms[room] = struct{}{}
+}
+
+// Leave removes the client from the room
+func (h *Hub) Leave(client *HubClient, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leave(client, room)
+}
+
+func (h *Hub) leave(client *HubClient, room string) {
+	delete(client.rooms, room)
+	delete(h.rooms[room], client)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Broadcast sends the message to all clients, returns the count of clients queued it
+func (h *Hub) Broadcast(messageType int, data []byte) int {
+	h.mu.RLock()
+	clients := make([]*HubClient, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+	return sendToClients(clients, messageType, data)
+}
+
+// BroadcastRoom sends the message to the clients in the room except the given ones
+func (h *Hub) BroadcastRoom(room string, messageType int, data []byte, except ...*HubClient) int {
+	h.mu.RLock()
+	clients := make([]*HubClient, 0, len(h.rooms[room]))
+walk:
+	for client := range h.rooms[room] {
+		for _, e := range except {
+			if client == e {
+				continue walk
+			}
+		}
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+	return sendToClients(clients, messageType, data)
+}
+
+// SendTo sends the message to the client with the id
+func (h *Hub) SendTo(id string, messageType int, data []byte) error {
+	client := h.Client(id)
+	if client == nil {
+		return HubClientClosedError
+	}
+	return client.Send(messageType, data)
+}
+
+// SendToUser sends the message to all connections of the user
+func (h *Hub) SendToUser(user string, messageType int, data []byte) int {
+	h.mu.RLock()
+	clients := make([]*HubClient, 0, len(h.users[user]))
+	for client := range h.users[user] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+	return sendToClients(clients, messageType, data)
+}
+
+// Client returns the client with the id, nil if not found
+func (h *Hub) Client(id string) *HubClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.clients[id]
+}
+
+// Count returns the count of connections
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// Members returns the clients in the room
+func (h *Hub) Members(room string) []*HubClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*HubClient, 0, len(h.rooms[room]))
+	for client := range h.rooms[room] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func sendToClients(clients []*HubClient, messageType int, data []byte) int {
+	count := 0
+	for _, client := range clients {
+		if client.Send(messageType, data) == nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,152 @@
+package regia
+
+import (
+	"testing"
+	"time"
+)
+
+func newHubServer(t *testing.T, hub *Hub) string {
+	t.Helper()
+	engine := New()
+	engine.AddStarter(hub)
+	t.Cleanup(hub.Close)
+	return newWebSocketServer(t, engine, func(ctx *Context) {
+		ctx.Data.Set("user", ctx.Request.Query().Get("user").String())
+		_ = hub.Serve(ctx)
+	})
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hubClients(hub *Hub) []*HubClient {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	clients := make([]*HubClient, 0, len(hub.clients))
+	for _, client := range hub.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// fill the socket buffers of a client never reading until its writePump is stuck,
+// Hub.DropOnFull must be true
+func stallClient(t *testing.T, client *HubClient) {
+	t.Helper()
+	data := make([]byte, 1<<20)
+	deadline := time.Now().Add(10 * time.Second)
+	for still := 0; still < 5; {
+		if time.Now().After(deadline) {
+			t.Fatal("the client is not stalled")
+		}
+		if err := client.Send(BinaryMessage, data); err == nil {
+			still = 0
+			continue
+		}
+		// the queue keeps full if the writePump is stuck
+		time.Sleep(20 * time.Millisecond)
+		if len(client.send) == cap(client.send) {
+			still++
+		} else {
+			still = 0
+		}
+	}
+}
+
+func TestHubRoomsAndUsers(t *testing.T) {
+	hub := NewHub()
+	hub.UserKey = "user"
+	url := newHubServer(t, hub)
+	alice := dialWebSocket(t, url+"?user=alice", nil)
+	alice2 := dialWebSocket(t, url+"?user=alice", nil)
+	bob := dialWebSocket(t, url+"?user=bob", nil)
+	waitFor(t, 5*time.Second, func() bool { return hub.Count() == 3 })
+
+	var bobClient *HubClient
+	for _, client := range hubClients(hub) {
+		if client.User == "bob" {
+			bobClient = client
+		}
+		client.Join("lobby")
+	}
+	if n := hub.SendToUser("alice", TextMessage, []byte("to alice")); n != 2 {
+		t.Fatalf("SendToUser = %d", n)
+	}
+	expectMessage(t, alice, TextMessage, []byte("to alice"))
+	expectMessage(t, alice2, TextMessage, []byte("to alice"))
+	if n := hub.BroadcastRoom("lobby", TextMessage, []byte("lobby"), bobClient); n != 2 {
+		t.Fatalf("BroadcastRoom = %d", n)
+	}
+	if err := hub.SendTo(bobClient.ID, TextMessage, []byte("to bob")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, bob, TextMessage, []byte("to bob"))
+
+	_ = bob.CloseWithCode(CloseNormalClosure, "")
+	waitFor(t, 5*time.Second, func() bool { return hub.Count() == 2 && len(hub.Members("lobby")) == 2 })
+	if err := hub.SendTo(bobClient.ID, TextMessage, []byte("gone")); err != HubClientClosedError {
+		t.Fatalf("SendTo a left client = %v", err)
+	}
+
+	hub.Close()
+	_, _, err := alice.ReadMessage()
+	for err == nil {
+		_, _, err = alice.ReadMessage()
+	}
+	expectCloseError(t, err, CloseGoingAway)
+}
+
+// the senders must not wait for the slow client they cut off
+func TestHubSlowClient(t *testing.T) {
+	hub := NewHub()
+	hub.QueueSize = 2
+	hub.DropOnFull = true
+	hub.WriteTimeout = 10 * time.Second
+	url := newHubServer(t, hub)
+	dialWebSocket(t, url, nil)
+	waitFor(t, 5*time.Second, func() bool { return hub.Count() == 1 })
+	stallClient(t, hubClients(hub)[0])
+	hub.DropOnFull = false
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		hub.Broadcast(BinaryMessage, []byte("overflow"))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Broadcast blocked %v on the slow client", elapsed)
+	}
+	// disconnected without waiting for WriteTimeout
+	waitFor(t, 3*time.Second, func() bool { return hub.Count() == 0 })
+}
+
+// a stalled peer must not block registering and broadcasting while pinging
+func TestHubPingStalledClient(t *testing.T) {
+	hub := NewHub()
+	hub.QueueSize = 2
+	hub.DropOnFull = true
+	hub.PingInterval = 20 * time.Millisecond
+	hub.WriteTimeout = 10 * time.Second
+	url := newHubServer(t, hub)
+	dialWebSocket(t, url, nil)
+	waitFor(t, 5*time.Second, func() bool { return hub.Count() == 1 })
+	stallClient(t, hubClients(hub)[0])
+	// let the ping get stuck on the stalled client
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	other := dialWebSocket(t, url, nil)
+	waitFor(t, time.Second, func() bool { return hub.Count() == 2 })
+	hub.Broadcast(TextMessage, []byte("hello"))
+	expectMessage(t, other, TextMessage, []byte("hello"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("blocked %v by the ping", elapsed)
+	}
+}
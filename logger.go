@@ -0,0 +1,274 @@
+package regia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+func (l LogLevel) color() int {
+	switch l {
+	case DebugLevel:
+		return colorMagenta
+	case InfoLevel:
+		return colorGreen
+	case WarnLevel:
+		return colorYellow
+	}
+	return colorRed
+}
+
+// Field is a key value pair of the structured log
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is the shortcut to make a Field
+func F(key string, value interface{}) Field { return Field{Key: key, Value: value} }
+
+// Logger is the leveled structured logger used by Engine
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+
+	// With returns a Logger always logs the fields
+	With(fields ...Field) Logger
+}
+
+// LogEntry is a line of log
+type LogEntry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	Fields  []Field
+}
+
+// LogEncoder encodes the entry to a line
+type LogEncoder interface {
+	Encode(entry *LogEntry) []byte
+}
+
+// JsonLogEncoder encodes the entry as a JSON object, such as
+// `{"time":"2006-01-02T15:04:05Z","level":"info","msg":"request","status":200}`
+type JsonLogEncoder struct {
+	// default time.RFC3339
+	TimeFormat string
+}
+
+func (j JsonLogEncoder) Encode(entry *LogEntry) []byte {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(`{"time":`)
+	writeJsonValue(buffer, entry.Time.Format(timeFormatOr(j.TimeFormat, time.RFC3339)))
+	buffer.WriteString(`,"level":`)
+	writeJsonValue(buffer, entry.Level.String())
+	buffer.WriteString(`,"msg":`)
+	writeJsonValue(buffer, entry.Message)
+	for _, field := range entry.Fields {
+		buffer.WriteByte(',')
+		writeJsonValue(buffer, field.Key)
+		buffer.WriteByte(':')
+		writeJsonValue(buffer, logValue(field.Value))
+	}
+	buffer.WriteString("}\n")
+	return buffer.Bytes()
+}
+
+func writeJsonValue(buffer *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buffer.Write(data)
+}
+
+// LogfmtEncoder encodes the entry as logfmt, such as
+// `time=2006-01-02T15:04:05Z level=info msg=request status=200`
+type LogfmtEncoder struct {
+	// default time.RFC3339
+	TimeFormat string
+}
+
+func (l LogfmtEncoder) Encode(entry *LogEntry) []byte {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("time=" + logfmtValue(entry.Time.Format(timeFormatOr(l.TimeFormat, time.RFC3339))))
+	buffer.WriteString(" level=" + entry.Level.String())
+	buffer.WriteString(" msg=" + logfmtValue(entry.Message))
+	for _, field := range entry.Fields {
+		buffer.WriteString(" " + logfmtKey(field.Key) + "=" + logfmtValue(fmt.Sprint(logValue(field.Value))))
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
+
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// TextLogEncoder encodes the entry for human, colored if Color is true
+type TextLogEncoder struct {
+	// default `2006-01-02 15:04:05`
+	TimeFormat string
+	Color      bool
+}
+
+func (t TextLogEncoder) Encode(entry *LogEntry) []byte {
+	paint := func(text string, color int) string {
+		if t.Color {
+			return formatColor(text, color)
+		}
+		return text
+	}
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(paint("[REGIA]", colorGreen) + " ")
+	buffer.WriteString(paint(entry.Time.Format(timeFormatOr(t.TimeFormat, defaultTimeFormat)), colorYellow) + " ")
+	buffer.WriteString(paint(fmt.Sprintf("%-5s", strings.ToUpper(entry.Level.String())), entry.Level.color()) + " ")
+	buffer.WriteString(entry.Message)
+	for _, field := range entry.Fields {
+		buffer.WriteString(" " + paint(field.Key+"=", colorBlue) + logfmtValue(fmt.Sprint(logValue(field.Value))))
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
+
+func timeFormatOr(format, def string) string {
+	if format == "" {
+		return def
+	}
+	return format
+}
+
+// readable values of the common types
+func logValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case time.Duration:
+		return value.String()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+// StdLogger writes the encoded entries to Writer
+type StdLogger struct {
+	Writer  io.Writer
+	Level   LogLevel
+	Encoder LogEncoder
+
+	fields []Field
+	mu     sync.Mutex
+
+	// the logger With was called on, its mu guards Writer for all the derived loggers
+	root *StdLogger
+}
+
+// NewLogger returns a logger of InfoLevel,
+// it writes colored text to a terminal and logfmt to others
+func NewLogger(writer io.Writer) *StdLogger {
+	var encoder LogEncoder = LogfmtEncoder{}
+	if IsTerminal(writer) {
+		encoder = TextLogEncoder{Color: true}
+	}
+	return &StdLogger{Writer: writer, Level: InfoLevel, Encoder: encoder}
+}
+
+// IsTerminal reports whether the writer is a terminal
+func IsTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (s *StdLogger) Debug(msg string, fields ...Field) { s.log(DebugLevel, msg, fields) }
+
+func (s *StdLogger) Info(msg string, fields ...Field) { s.log(InfoLevel, msg, fields) }
+
+func (s *StdLogger) Warn(msg string, fields ...Field) { s.log(WarnLevel, msg, fields) }
+
+func (s *StdLogger) Error(msg string, fields ...Field) { s.log(ErrorLevel, msg, fields) }
+
+func (s *StdLogger) With(fields ...Field) Logger {
+	root := s.root
+	if root == nil {
+		root = s
+	}
+	return &StdLogger{
+		Writer:  s.Writer,
+		Level:   s.Level,
+		Encoder: s.Encoder,
+		fields:  append(append([]Field(nil), s.fields...), fields...),
+		root:    root,
+	}
+}
+
+func (s *StdLogger) log(level LogLevel, msg string, fields []Field) {
+	if level < s.Level {
+		return
+	}
+	if len(s.fields) > 0 {
+		fields = append(append([]Field(nil), s.fields...), fields...)
+	}
+	encoder := s.Encoder
+	if encoder == nil {
+		encoder = LogfmtEncoder{}
+	}
+	s.write(encoder.Encode(&LogEntry{Time: time.Now(), Level: level, Message: msg, Fields: fields}))
+}
+
+func (s *StdLogger) write(data []byte) {
+	mu := &s.mu
+	if s.root != nil {
+		mu = &s.root.mu
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, _ = s.Writer.Write(data)
+}
@@ -0,0 +1,148 @@
+package regia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLogEntry() *LogEntry {
+	return &LogEntry{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:   InfoLevel,
+		Message: "request done",
+		Fields: []Field{
+			F("status", 200),
+			F("latency", 1500*time.Millisecond),
+			F("err", errors.New(`bad "input"`)),
+			F("level", WarnLevel),
+			F("tags", []string{"a", "b"}),
+			F("chan", make(chan int)),
+		},
+	}
+}
+
+func TestJsonLogEncoder(t *testing.T) {
+	line := JsonLogEncoder{}.Encode(testLogEntry())
+	if !bytes.HasSuffix(line, []byte("}\n")) || bytes.Count(line, []byte("\n")) != 1 {
+		t.Fatalf("line = %q", line)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("%v: %q", err, line)
+	}
+	want := map[string]interface{}{
+		"time":    "2024-01-02T03:04:05Z",
+		"level":   "warn",
+		"msg":     "request done",
+		"status":  float64(200),
+		"latency": "1.5s",
+		"err":     `bad "input"`,
+		"tags":    []interface{}{"a", "b"},
+	}
+	for key, value := range want {
+		if got, _ := json.Marshal(decoded[key]); string(got) != mustJson(t, value) {
+			t.Errorf("%s = %s, want %s", key, got, mustJson(t, value))
+		}
+	}
+	// the values json can't encode are formatted
+	if s, ok := decoded["chan"].(string); !ok || !strings.HasPrefix(s, "0x") {
+		t.Errorf("chan = %v", decoded["chan"])
+	}
+	// the entry keys come first, a field of the same key follows them
+	if !bytes.HasPrefix(line, []byte(`{"time":"2024-01-02T03:04:05Z","level":"info","msg":"request done","status":200,`)) {
+		t.Errorf("line = %s", line)
+	}
+
+	custom := JsonLogEncoder{TimeFormat: time.Kitchen}.Encode(&LogEntry{Time: time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC)})
+	if string(custom) != `{"time":"3:04PM","level":"debug","msg":""}`+"\n" {
+		t.Errorf("custom = %s", custom)
+	}
+}
+
+func mustJson(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	entry := testLogEntry()
+	entry.Fields = append(entry.Fields[:5], F("user id", "a=b"), F("empty", ""))
+	got := string(LogfmtEncoder{}.Encode(entry))
+	want := `time=2024-01-02T03:04:05Z level=info msg="request done" status=200 latency=1.5s err="bad \"input\"" level=warn tags="[a b]" user_id="a=b" empty=""` + "\n"
+	if got != want {
+		t.Fatalf("logfmt\n got %s\nwant %s", got, want)
+	}
+	multiline := string(LogfmtEncoder{}.Encode(&LogEntry{Time: entry.Time, Message: "line1\nline2"}))
+	if strings.Count(multiline, "\n") != 1 || !strings.Contains(multiline, `msg="line1\nline2"`) {
+		t.Fatalf("multiline = %q", multiline)
+	}
+}
+
+func TestTextLogEncoder(t *testing.T) {
+	got := string(TextLogEncoder{}.Encode(&LogEntry{
+		Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Level: ErrorLevel, Message: "failed", Fields: []Field{F("path", "/a b")},
+	}))
+	if got != `[REGIA] 2024-01-02 03:04:05 ERROR failed path="/a b"`+"\n" {
+		t.Fatalf("text = %q", got)
+	}
+	if colored := string(TextLogEncoder{Color: true}.Encode(&LogEntry{Message: "m"})); !strings.Contains(colored, "\x1b[") {
+		t.Fatalf("colored = %q", colored)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := NewLogger(buffer)
+	logger.Debug("hidden")
+	logger.Info("shown", F("a", 1))
+	child := logger.With(F("request_id", "r1"))
+	child.Warn("child", F("b", 2))
+	logger.Error("parent")
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "level=info msg=shown a=1") ||
+		!strings.HasSuffix(lines[1], "level=warn msg=child request_id=r1 b=2") ||
+		!strings.HasSuffix(lines[2], "level=error msg=parent") {
+		t.Fatalf("lines = %q", lines)
+	}
+}
+
+// unsafeWriter is caught by the race detector if it is written concurrently
+type unsafeWriter struct{ lines int }
+
+func (u *unsafeWriter) Write(data []byte) (int, error) {
+	u.lines++
+	return len(data), nil
+}
+
+// the zero value and the loggers derived by With share one lock of the writer
+func TestStdLoggerConcurrent(t *testing.T) {
+	writer := &unsafeWriter{}
+	logger := &StdLogger{Writer: writer}
+	loggers := []Logger{logger, logger.With(F("a", 1)), logger.With(F("a", 1)).With(F("b", 2))}
+	var wg sync.WaitGroup
+	for _, l := range loggers {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(l Logger) {
+				defer wg.Done()
+				l.Info("concurrent")
+			}(l)
+		}
+	}
+	wg.Wait()
+	if writer.lines != 30 {
+		t.Fatalf("lines = %d", writer.lines)
+	}
+}
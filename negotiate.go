@@ -0,0 +1,116 @@
+package regia
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	jsonMediaType  = "application/json"
+	xmlMediaType   = "application/xml"
+	textXmlMedia   = "text/xml"
+	htmlMediaType  = "text/html"
+	plainMediaType = "text/plain"
+)
+
+// NotAcceptableError will be returned by Response.Negotiate if no render matches the Accept header
+var NotAcceptableError = errors.New("not acceptable")
+
+// Negotiation lets Response.Negotiate render the html template,
+// HTML is offered only if HtmlName is set
+type Negotiation struct {
+	Data interface{}
+
+	// template name for HtmlRender
+	HtmlName string
+
+	// data for the template, default Data
+	HtmlData interface{}
+}
+
+// TextRender writes the data as plain text with fmt.Fprint
+type TextRender struct{}
+
+func (t TextRender) Render(writer http.ResponseWriter, v interface{}) error {
+	writeContentType(writer, textPlainContentType)
+	_, err := fmt.Fprint(writer, v)
+	return err
+}
+
+type htmlNameRender struct {
+	HtmlRender HtmlRender
+	Name       string
+}
+
+func (h htmlNameRender) Render(writer http.ResponseWriter, v interface{}) error {
+	return h.HtmlRender.Render(writer, h.Name, v)
+}
+
+type mediaRender struct {
+	mediaType string
+	render    Render
+	data      interface{}
+}
+
+// collect the renders could be chosen, built in renders come first
+func (r *Response) negotiateRenders(data interface{}) []mediaRender {
+	engine := r.Context.Engine
+	negotiation, ok := data.(Negotiation)
+	if !ok {
+		negotiation = Negotiation{Data: data}
+	}
+	renders := []mediaRender{
+		{jsonMediaType, JsonRender{Serializer: engine.JsonSerializer}, negotiation.Data},
+		{xmlMediaType, XmlRender{Serializer: engine.XmlSerializer, ContentType: xmlContentType}, negotiation.Data},
+		{textXmlMedia, XmlRender{Serializer: engine.XmlSerializer}, negotiation.Data},
+	}
+	if negotiation.HtmlName != "" {
+		htmlData := negotiation.HtmlData
+		if htmlData == nil {
+			htmlData = negotiation.Data
+		}
+		renders = append(renders, mediaRender{htmlMediaType, htmlNameRender{engine.HtmlRender, negotiation.HtmlName}, htmlData})
+	}
+	renders = append(renders, mediaRender{plainMediaType, TextRender{}, negotiation.Data})
+
+	mediaTypes := make([]string, 0, len(engine.Renders))
+	for mediaType := range engine.Renders {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		render := mediaRender{mediaType, engine.Renders[mediaType], negotiation.Data}
+		replaced := false
+		for i := range renders {
+			if renders[i].mediaType == mediaType {
+				renders[i], replaced = render, true
+			}
+		}
+		if !replaced {
+			renders = append(renders, render)
+		}
+	}
+	return renders
+}
+
+// Negotiate chooses the render by the Accept header of the request and writes the data with status.
+// JSON is preferred if the client accepts anything.
+// It responds 406 and returns NotAcceptableError if nothing matches.
+func (r *Response) Negotiate(status int, data interface{}) error {
+	renders := r.negotiateRenders(data)
+	offers := make([]string, len(renders))
+	for i, render := range renders {
+		offers[i] = render.mediaType
+	}
+	best := r.Context.Request.Header().Accept().Best(offers...)
+	for _, render := range renders {
+		if render.mediaType == best {
+			addVary(r.Header(), "Accept")
+			return r.renderStatus(status, render.render, render.data)
+		}
+	}
+	http.Error(r.ResponseWriter, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+	return NotAcceptableError
+}
@@ -0,0 +1,90 @@
+package regia
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type negotiateUser struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func (u negotiateUser) String() string { return "user " + u.Name }
+
+type csvRender struct{}
+
+func (csvRender) Render(writer http.ResponseWriter, v interface{}) error {
+	writer.Header().Set(contentType, "text/csv")
+	_, err := fmt.Fprintf(writer, "name\n%s\n", v.(negotiateUser).Name)
+	return err
+}
+
+func TestNegotiate(t *testing.T) {
+	engine := New()
+	engine.HtmlRender = TemplateRender{template.Must(template.New("user.html").Parse(`<b>{{.Name}}</b>`))}
+	engine.Renders = map[string]Render{"text/csv": csvRender{}}
+	var negotiateErr error
+	user := negotiateUser{Name: "alice"}
+	engine.GET("/user", func(ctx *Context) {
+		negotiateErr = ctx.Response.Negotiate(http.StatusCreated, user)
+	})
+	engine.GET("/page", func(ctx *Context) {
+		negotiateErr = ctx.Response.Negotiate(http.StatusOK, Negotiation{Data: user, HtmlName: "user.html"})
+	})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, accept      string
+		status            int
+		contentType, body string
+	}{
+		{"/user", "application/json", http.StatusCreated, jsonContentType, `{"name":"alice"}`},
+		{"/user", "application/xml", http.StatusCreated, xmlContentType, `<negotiateUser><name>alice</name></negotiateUser>`},
+		{"/user", "text/xml", http.StatusCreated, textXmlContentType, `<negotiateUser><name>alice</name></negotiateUser>`},
+		{"/user", "text/plain", http.StatusCreated, textPlainContentType, "user alice"},
+		{"/user", "text/csv", http.StatusCreated, "text/csv", "name\nalice\n"},
+		// JSON is preferred if anything is accepted
+		{"/user", "", http.StatusCreated, jsonContentType, `{"name":"alice"}`},
+		{"/user", "*/*", http.StatusCreated, jsonContentType, `{"name":"alice"}`},
+		{"/user", "application/json;q=0, */*", http.StatusCreated, xmlContentType, `<negotiateUser><name>alice</name></negotiateUser>`},
+		{"/user", "text/*;q=0.5, application/xml;q=0.4", http.StatusCreated, textXmlContentType, `<negotiateUser><name>alice</name></negotiateUser>`},
+		// HTML is offered only with a template name
+		{"/user", "text/html", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"},
+		{"/page", "text/html, application/json;q=0.9", http.StatusOK, textHtmlContentType, "<b>alice</b>"},
+	}
+	for _, test := range tests {
+		negotiateErr = nil
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		header := recorder.Header()
+		if recorder.Code != test.status || header.Get(contentType) != test.contentType || recorder.Body.String() != test.body {
+			t.Errorf("%s Accept %q: %d %q %q", test.path, test.accept, recorder.Code, header.Get(contentType), recorder.Body)
+			continue
+		}
+		if (negotiateErr == NotAcceptableError) != (test.status == http.StatusNotAcceptable) {
+			t.Errorf("%s Accept %q: Negotiate = %v", test.path, test.accept, negotiateErr)
+		}
+		if test.status != http.StatusNotAcceptable && header.Get("Vary") != "Accept" {
+			t.Errorf("%s Accept %q: Vary %q", test.path, test.accept, header.Get("Vary"))
+		}
+	}
+}
+
+func TestNegotiateOverrideRender(t *testing.T) {
+	engine := New()
+	engine.Renders = map[string]Render{jsonMediaType: JsonRender{Serializer: engine.JsonSerializer, Indent: "  "}}
+	engine.GET("/", func(ctx *Context) { _ = ctx.Response.Negotiate(http.StatusOK, Map{"a": 1}) })
+	recorder := serveTest(t, engine, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := recorder.Body.String(); body != "{\n  \"a\": 1\n}" {
+		t.Fatalf("body = %q", body)
+	}
+}
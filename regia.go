@@ -3,13 +3,22 @@ package regia
 // To Regia
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const (
 	FilePathParam = "FilePathParam"
 	wildFilepath  = "*" + FilePathParam
+
+	defaultShutdownTimeout   = 10 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
 )
 
 // Engine is a collection of core components of the whole service
@@ -36,9 +45,14 @@ type Engine struct {
 	// reset it to other module
 	XmlSerializer Serializer
 
+	// Extra renders chosen by Response.Negotiate, keyed by media type
+	// JSON, XML, HTML and plain text are built in
+	// add one to override the built in render of the same media type
+	Renders map[string]Render
+
 	// Context.SaveUploadFile will call this interface
-	// default save file to your local desk
-	// reset it to your onw idea
+	// default save file to the working directory of your local desk
+	// reset it to your own idea, such as MemoryFileStorage or S3FileStorage
 	FileStorage FileStorage
 
 	// Context Abort use
@@ -54,26 +68,82 @@ type Engine struct {
 	Interceptors HandleFuncGroup
 
 	// Starter will run when the service starts
-	// and it only run once
+	// and it only run once, ordered by phases and dependencies
 	Starters []Starter
 
+	// Stopper will run after the server shut down
+	// in reverse order of registration
+	Stoppers []Stopper
+
+	// Grace period to wait for the active requests while shutting down
+	// default 10 seconds
+	ShutdownTimeout time.Duration
+
+	// Timeouts and limits of http.Server, 0 means no limit
+	// ReadHeaderTimeout default 10 seconds
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// Serve HTTP/2 without TLS (h2c) besides HTTP/1, such as behind a gRPC aware proxy
+	H2C bool
+
+	// Max count of the concurrent connections, 0 means no limit
+	// the listener stops accepting until a connection closed
+	MaxConnections int
+
+	// Server is the underlying http.Server created by Run
+	// set it before Run for advanced tuning, the zero timeouts of it are filled by Engine
+	Server *http.Server
+
 	// Warehouse is used to store information
 	Warehouse Warehouse
 
+	// Logger is used by LogInterceptor and the built in starters
+	// default writes colored text to a terminal, logfmt to others
+	Logger Logger
+
+	// Keyring is used to sign and encrypt cookies
+	// default nil, set it before using signed or encrypted cookies
+	Keyring *Keyring
+
 	// Mat multipart form memory size
 	// default 32M
 	MultipartFormMaxMemory int64
+
+	// static files served at `/` for the requests no route matched
+	rootStatic HandleFuncGroup
+
+	// receive the signals to shut down
+	quit chan os.Signal
+
+	// address of the listener
+	addr net.Addr
+
+	// called when the graceful shutdown begins
+	shutdownHooks []func()
+
+	// the starters have started, in order
+	started []Starter
 }
 
 // register all handles to router
 func (e *Engine) registerHandle() {
 	for method, nodes := range e.methodsTree {
 		for _, node := range nodes {
-			e.Router.Insert(method, node.path, node.group)
+			// record the pattern for Context.Route
+			group := append(HandleFuncGroup{routePattern(node.path)}, node.group...)
+			e.Router.Insert(method, node.path, group)
 		}
 	}
 }
 
+func routePattern(path string) HandleFunc {
+	return func(ctx *Context) { ctx.route = path }
+}
+
 // Setter for Engine.NotFoundHandle
 func (e *Engine) SetNotFoundHandle(handle HandleFunc) {
 	e.NotFoundHandle = handle
@@ -81,22 +151,7 @@ func (e *Engine) SetNotFoundHandle(handle HandleFunc) {
 
 // Serve static files
 func (e *Engine) Static(url, dir string, group ...HandleFunc) {
-	if strings.Contains(url, "*") {
-		panic("`url` should not have wildcards")
-	}
-	server := http.FileServer(http.Dir(dir))
-	handle := func(ctx *Context) {
-		ctx.Raw.Request.URL.Path = ctx.Request.Params.Get(FilePathParam).String()
-		server.ServeHTTP(ctx.Raw.Writer, ctx.Raw.Request)
-	}
-	group = append(group, handle)
-	if !strings.HasSuffix(url, FilePathParam) {
-		if !strings.HasSuffix(url, "/") {
-			url += "/"
-		}
-		url += wildFilepath
-	}
-	e.Handle(http.MethodGet, url, group...)
+	e.StaticFS(url, http.Dir(dir), StaticOptions{}, group...)
 }
 
 // Add interceptor to Engine
@@ -104,28 +159,180 @@ func (e *Engine) AddInterceptors(interceptors ...HandleFunc) {
 	e.Interceptors = append(e.Interceptors, interceptors...)
 }
 
+// Add render for Response.Negotiate
+func (e *Engine) AddRender(mediaType string, render Render) {
+	if e.Renders == nil {
+		e.Renders = make(map[string]Render)
+	}
+	e.Renders[mediaType] = render
+}
+
 // Add starter to Engine
 func (e *Engine) AddStarter(starters ...Starter) {
 	e.Starters = append(e.Starters, starters...)
 }
 
-// Call all starters of this engine
-func (e *Engine) runStarter() {
-	for _, starter := range e.Starters {
-		starter.Start(e)
+// Add stopper to Engine
+func (e *Engine) AddStopper(stoppers ...Stopper) {
+	e.Stoppers = append(e.Stoppers, stoppers...)
+}
+
+// Call the starters of the phase in order of dependencies
+func (e *Engine) runStarter(phase StartPhase) error {
+	starters, err := orderStarters(e.Starters, phase)
+	if err != nil {
+		return err
+	}
+	for _, starter := range starters {
+		if err := starter.Start(e); err != nil {
+			return fmt.Errorf("regia: starter %s: %w", starterName(starter), err)
+		}
+		e.started = append(e.started, starter)
+	}
+	return nil
+}
+
+// Call the stoppers of this engine in reverse order,
+// the stoppers registered as starters are skipped if they have not started
+// because a starter before them failed
+func (e *Engine) runStopper() {
+	for i := len(e.Stoppers) - 1; i >= 0; i-- {
+		stopper := e.Stoppers[i]
+		if containsStarter(e.Starters, stopper) && !containsStarter(e.started, stopper) {
+			continue
+		}
+		stopper.Stop(e)
 	}
 }
 
 // Init engine
-func (e *Engine) init() {
+func (e *Engine) init() error {
+	if err := e.runStarter(BeforeRoutes); err != nil {
+		return err
+	}
 	e.registerHandle()
-	e.runStarter()
+	return e.runStarter(AfterRoutes)
 }
 
 // Start Listen and serve
+// it shuts down gracefully on SIGINT or SIGTERM
 func (e *Engine) Run(addr string) error {
-	e.init()
-	return http.ListenAndServe(addr, e)
+	if addr == "" {
+		addr = ":http"
+	}
+	server := e.newServer(addr)
+	listen := func() (net.Listener, error) { return net.Listen("tcp", addr) }
+	return e.run(server, listen, server.Serve)
+}
+
+// Addr returns the address of the listener, it is nil before listening
+func (e *Engine) Addr() net.Addr {
+	return e.addr
+}
+
+// returns Engine.Server with the configuration of Engine
+func (e *Engine) newServer(addr string) *http.Server {
+	if e.Server == nil {
+		e.Server = &http.Server{}
+	}
+	server := e.Server
+	server.Addr = addr
+	if server.Handler == nil {
+		server.Handler = e
+	}
+	if server.ReadTimeout == 0 {
+		server.ReadTimeout = e.ReadTimeout
+	}
+	if server.ReadHeaderTimeout == 0 {
+		server.ReadHeaderTimeout = e.ReadHeaderTimeout
+	}
+	if server.WriteTimeout == 0 {
+		server.WriteTimeout = e.WriteTimeout
+	}
+	if server.IdleTimeout == 0 {
+		server.IdleTimeout = e.IdleTimeout
+	}
+	if server.MaxHeaderBytes == 0 {
+		server.MaxHeaderBytes = e.MaxHeaderBytes
+	}
+	if e.H2C && server.Protocols == nil {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = protocols
+	}
+	return server
+}
+
+// init the engine, listen and serve,
+// the stoppers will run if all starters succeed
+func (e *Engine) run(server *http.Server, listen func() (net.Listener, error), serve func(net.Listener) error) error {
+	if err := e.init(); err != nil {
+		e.runStopper()
+		return err
+	}
+	listener, err := listen()
+	if err != nil {
+		e.runStopper()
+		return err
+	}
+	e.addr = listener.Addr()
+	if e.MaxConnections > 0 {
+		listener = newLimitListener(listener, e.MaxConnections)
+	}
+	if err := e.runStarter(AfterListen); err != nil {
+		listener.Close()
+		e.runStopper()
+		return err
+	}
+	return e.serve(server, func() error { return serve(listener) })
+}
+
+// OnShutdown registers the function called when the graceful shutdown begins,
+// before the server stops accepting requests
+func (e *Engine) OnShutdown(hook func()) {
+	e.shutdownHooks = append(e.shutdownHooks, hook)
+}
+
+// Shutdown gracefully stops the running server, the same as receiving SIGTERM
+func (e *Engine) Shutdown() {
+	if e.quit != nil {
+		select {
+		case e.quit <- syscall.SIGTERM:
+		default:
+		}
+	}
+}
+
+// serve until the signal received, then shutdown the server and run the stoppers
+func (e *Engine) serve(server *http.Server, listenAndServe func() error) error {
+	if e.quit == nil {
+		e.quit = make(chan os.Signal, 1)
+	}
+	signal.Notify(e.quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(e.quit)
+
+	errs := make(chan error, 1)
+	go func() { errs <- listenAndServe() }()
+	select {
+	case err := <-errs:
+		e.runStopper()
+		return err
+	case <-e.quit:
+	}
+	for _, hook := range e.shutdownHooks {
+		hook()
+	}
+	timeout := e.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	e.runStopper()
+	return err
 }
 
 // Handle input request
@@ -134,6 +341,9 @@ func (e *Engine) handleRequest(ctx *Context) {
 	if group, params := e.Router.Match(ctx.Raw.Request); group != nil {
 		ctx.Request.Params = params
 		ctx.group = append(ctx.group, group...)
+	} else if e.rootStatic != nil && (ctx.Raw.Request.Method == http.MethodGet || ctx.Raw.Request.Method == http.MethodHead) {
+		ctx.Request.Params = Params{{Key: FilePathParam, Value: ctx.Raw.Request.URL.Path}}
+		ctx.group = append(ctx.group, e.rootStatic...)
 	} else {
 		ctx.group = append(ctx.group, e.NotFoundHandle)
 	}
@@ -155,7 +365,7 @@ func (e *Engine) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 func New() *Engine {
 	engine := &Engine{
 		Router:                 make(HttpRouter),
-		FileStorage:            &FileSystemStorage{},
+		FileStorage:            NewLocalFileStorage(".", ""),
 		Branch:                 NewBranch(),
 		JsonSerializer:         JsonSerializer{},
 		XmlSerializer:          XmlSerializer{},
@@ -163,7 +373,10 @@ func New() *Engine {
 		Abort:                  exit{},
 		NotFoundHandle:         HandleNotFound,
 		Warehouse:              new(Data),
+		Logger:                 NewLogger(os.Stdout),
 		MultipartFormMaxMemory: 32 << 20, // 32 MB
+		ReadHeaderTimeout:      defaultReadHeaderTimeout,
+		quit:                   make(chan os.Signal, 1),
 	}
 	return engine
 }
@@ -1,6 +1,9 @@
 package regia
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 )
@@ -11,28 +14,84 @@ type Render interface {
 
 type JsonRender struct {
 	Serializer Serializer
+
+	// indent the json if not empty
+	Indent string
 }
 
 func (j JsonRender) Render(writer http.ResponseWriter, v interface{}) error {
-	writeContentType(writer, jsonContentType)
 	data, err := j.Serializer.Marshal(v)
 	if err != nil {
 		return err
 	}
+	if j.Indent != "" {
+		buffer := &bytes.Buffer{}
+		if err := json.Indent(buffer, data, "", j.Indent); err != nil {
+			return err
+		}
+		data = buffer.Bytes()
+	}
+	writeContentType(writer, jsonContentType)
 	_, err = writer.Write(data)
 	return err
 }
 
+var invalidCallbackError = errors.New("invalid jsonp callback")
+
+type JsonpRender struct {
+	Serializer Serializer
+	Callback   string
+}
+
+func (j JsonpRender) Render(writer http.ResponseWriter, v interface{}) error {
+	// only javascript identifiers are allowed to avoid XSS
+	if !validCallback(j.Callback) {
+		return invalidCallbackError
+	}
+	data, err := j.Serializer.Marshal(v)
+	if err != nil {
+		return err
+	}
+	writeContentType(writer, javascriptContentType)
+	buffer := bytes.NewBufferString("/**/" + j.Callback + "(")
+	buffer.Write(data)
+	buffer.WriteString(");")
+	_, err = writer.Write(buffer.Bytes())
+	return err
+}
+
+func validCallback(callback string) bool {
+	if callback == "" {
+		return false
+	}
+	for i, c := range callback {
+		switch {
+		case c == '_' || c == '$' || c == '.' && i > 0:
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 type XmlRender struct {
 	Serializer Serializer
+
+	// default `text/xml;charset=utf-8`
+	ContentType string
 }
 
 func (x XmlRender) Render(writer http.ResponseWriter, v interface{}) error {
-	writeContentType(writer, textXmlContentType)
 	data, err := x.Serializer.Marshal(v)
 	if err != nil {
 		return err
 	}
+	if x.ContentType == "" {
+		x.ContentType = textXmlContentType
+	}
+	writeContentType(writer, x.ContentType)
 	_, err = writer.Write(data)
 	return err
 }
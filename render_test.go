@@ -0,0 +1,84 @@
+package regia
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseStatus(t *testing.T) {
+	data := Map{"a": 1}
+	tests := []struct {
+		name        string
+		handle      func(ctx *Context) error
+		status      int
+		contentType string
+		body        string
+	}{
+		{"json", func(ctx *Context) error { return ctx.Response.Status(http.StatusCreated).Json(data) },
+			http.StatusCreated, jsonContentType, `{"a":1}`},
+		{"pretty json", func(ctx *Context) error { return ctx.Response.Status(http.StatusAccepted).PrettyJson(data) },
+			http.StatusAccepted, jsonContentType, "{\n  \"a\": 1\n}"},
+		{"jsonp", func(ctx *Context) error { return ctx.Response.Status(http.StatusCreated).Jsonp("jQuery_1.cb", data) },
+			http.StatusCreated, javascriptContentType, `/**/jQuery_1.cb({"a":1});`},
+		{"xml", func(ctx *Context) error { return ctx.Response.Status(http.StatusCreated).Xml(negotiateUser{Name: "a"}) },
+			http.StatusCreated, textXmlContentType, `<negotiateUser><name>a</name></negotiateUser>`},
+		{"html", func(ctx *Context) error { return ctx.Response.Status(http.StatusNotFound).Html("page", "a") },
+			http.StatusNotFound, textHtmlContentType, "<p>a</p>"},
+		{"bytes", func(ctx *Context) error {
+			_, err := ctx.Response.Status(http.StatusCreated).Bytes("image/png", []byte{1, 2})
+			return err
+		}, http.StatusCreated, "image/png", "\x01\x02"},
+		{"string", func(ctx *Context) error {
+			_, err := ctx.Response.Status(http.StatusBadRequest).String("bad %s", "input")
+			return err
+		}, http.StatusBadRequest, textHtmlContentType, "bad input"},
+		{"default", func(ctx *Context) error { return ctx.Response.Json(data) },
+			http.StatusOK, jsonContentType, `{"a":1}`},
+		// the status is consumed by the failed render, nothing has been sent
+		{"failed render", func(ctx *Context) error {
+			if err := ctx.Response.Status(http.StatusCreated).Jsonp("alert(1)", data); err != invalidCallbackError {
+				t.Errorf("Jsonp with an invalid callback = %v", err)
+			}
+			if err := ctx.Response.Status(http.StatusCreated).Json(make(chan int)); err == nil {
+				t.Error("Json of a channel succeeded")
+			}
+			_, err := ctx.Response.String("failed")
+			return err
+		}, http.StatusOK, textHtmlContentType, "failed"},
+	}
+	for _, test := range tests {
+		engine := New()
+		engine.HtmlRender = TemplateRender{template.Must(template.New("page").Parse(`<p>{{.}}</p>`))}
+		engine.GET("/", func(ctx *Context) {
+			if err := test.handle(ctx); err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		})
+		recorder := serveTest(t, engine, httptest.NewRequest(http.MethodGet, "/", nil))
+		if recorder.Code != test.status || recorder.Header().Get(contentType) != test.contentType || recorder.Body.String() != test.body {
+			t.Errorf("%s: %d %q %q", test.name, recorder.Code, recorder.Header().Get(contentType), recorder.Body)
+		}
+	}
+}
+
+func TestValidCallback(t *testing.T) {
+	for callback, valid := range map[string]bool{
+		"cb":       true,
+		"$":        true,
+		"_a.b":     true,
+		"a1":       true,
+		"":         false,
+		"1a":       false,
+		".a":       false,
+		"a-b":      false,
+		"alert(1)": false,
+		"a;b":      false,
+		"a b":      false,
+	} {
+		if validCallback(callback) != valid {
+			t.Errorf("validCallback(%q) = %v", callback, !valid)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package regia
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion   = "us-east-1"
+	s3DefaultPartSize = 5 << 20 // the minimum part size of multipart upload
+	s3TimeFormat      = "20060102T150405Z"
+)
+
+// S3FileStorage stores files in a bucket of S3 compatible service,
+// such as AWS S3, MinIO and Ceph. The requests are signed with AWS Signature Version 4.
+// Large files are uploaded as multipart upload, so only PartSize bytes are buffered.
+type S3FileStorage struct {
+	// such as `https://s3.us-east-1.amazonaws.com` or `http://127.0.0.1:9000`
+	Endpoint string
+
+	// default us-east-1
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// prefix of URL, default `Endpoint/Bucket`
+	BaseURL string
+
+	// Overwrite the existing object, default false means save it with another name
+	Overwrite bool
+
+	// size of every part of multipart upload, default 5MB
+	PartSize int64
+
+	// default http.DefaultClient
+	Client *http.Client
+}
+
+// S3Error is the error response of S3 service
+type S3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func NewS3FileStorage(endpoint, region, bucket, accessKey, secretKey string) *S3FileStorage {
+	return &S3FileStorage{Endpoint: endpoint, Region: region, Bucket: bucket, AccessKey: accessKey, SecretKey: secretKey}
+}
+
+func (s *S3FileStorage) Save(name string, reader io.Reader) (string, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return "", err
+	}
+	for !s.Overwrite {
+		if _, err := s.Stat(name); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		name = collisionFreeName(name)
+	}
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = s3DefaultPartSize
+	}
+	buffer := make([]byte, partSize)
+	n, err := io.ReadFull(reader, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// small file, upload it with one request
+		resp, err := s.do(http.MethodPut, name, nil, buffer[:n])
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, s.multipartUpload(name, buffer, reader)
+}
+
+func (s *S3FileStorage) multipartUpload(name string, buffer []byte, reader io.Reader) error {
+	var initiate struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := s.doXml(http.MethodPost, name, url.Values{"uploads": {""}}, nil, &initiate); err != nil {
+		return err
+	}
+	type completePart struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+		Parts   []completePart `xml:"Part"`
+	}
+	err := func() error {
+		n := len(buffer)
+		for number := 1; n > 0; number++ {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiate.UploadId}}
+			resp, err := s.do(http.MethodPut, name, query, buffer[:n])
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			complete.Parts = append(complete.Parts, completePart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+			n, err = io.ReadFull(reader, buffer)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		return s.doXml(http.MethodPost, name, url.Values{"uploadId": {initiate.UploadId}}, body, nil)
+	}()
+	if err != nil {
+		if resp, abortErr := s.do(http.MethodDelete, name, url.Values{"uploadId": {initiate.UploadId}}, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+	}
+	return err
+}
+
+func (s *S3FileStorage) Open(name string) (io.ReadCloser, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, s.notExist("open", name, err)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3FileStorage) Stat(name string) (*FileInfo, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodHead, name, nil, nil)
+	if err != nil {
+		return nil, s.notExist("stat", name, err)
+	}
+	resp.Body.Close()
+	info := &FileInfo{Name: name, Size: resp.ContentLength, ContentType: resp.Header.Get(contentType)}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	if info.ContentType == "" {
+		info.ContentType = contentTypeByName(name)
+	}
+	return info, nil
+}
+
+func (s *S3FileStorage) Delete(name string) error {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return s.notExist("remove", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3FileStorage) URL(name string) string {
+	name, _ = CleanFileName(name)
+	if s.BaseURL != "" {
+		return joinURL(s.BaseURL, name)
+	}
+	return s.objectURL(name)
+}
+
+// convert 404 to the error satisfies os.IsNotExist
+func (s *S3FileStorage) notExist(op, name string, err error) error {
+	if e, ok := err.(*S3Error); ok && e.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (s *S3FileStorage) objectURL(name string) string {
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + s3Escape(s.Bucket, false) + "/" + s3Escape(name, false)
+}
+
+func (s *S3FileStorage) doXml(method, name string, query url.Values, body []byte, v interface{}) error {
+	resp, err := s.do(method, name, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// CompleteMultipartUpload may respond an error with status 200
+	if bytes.Contains(data, []byte("<Error>")) {
+		e := &S3Error{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(data, e)
+		return e
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func (s *S3FileStorage) do(method, name string, query url.Values, body []byte) (*http.Response, error) {
+	rawURL := s.objectURL(name)
+	if len(query) > 0 {
+		rawURL += "?" + s3CanonicalQuery(query)
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		// do not send `Transfer-Encoding: chunked`
+		req.Body = http.NoBody
+	}
+	s.sign(req, body, time.Now().UTC())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		e := &S3Error{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode)}
+		if data, err := io.ReadAll(resp.Body); err == nil {
+			_ = xml.Unmarshal(data, e)
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// sign the request with AWS Signature Version 4
+func (s *S3FileStorage) sign(req *http.Request, body []byte, now time.Time) {
+	region := s.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format(s3TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(req.Header.Get(key))
+	}
+	names := make([]string, 0, len(headers))
+	for key := range headers {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, key := range names {
+		canonicalHeaders.WriteString(key + ":" + headers[key] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := now.Format("20060102") + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{now.Format("20060102"), region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escape everything except the unreserved characters as S3 required
+func s3Escape(s string, escapeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
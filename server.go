@@ -0,0 +1,184 @@
+package regia
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// RunTLS listens and serves HTTPS, certFile and keyFile can be empty if config has the certificates
+func (e *Engine) RunTLS(addr, certFile, keyFile string, config ...*tls.Config) error {
+	if addr == "" {
+		addr = ":https"
+	}
+	server := e.newServer(addr)
+	if len(config) > 0 {
+		server.TLSConfig = config[0]
+	}
+	listen := func() (net.Listener, error) { return net.Listen("tcp", addr) }
+	return e.run(server, listen, func(listener net.Listener) error {
+		return server.ServeTLS(listener, certFile, keyFile)
+	})
+}
+
+// RunUnix listens and serves on the unix socket file, such as behind nginx.
+// The stale socket file left by a crashed process is removed before listening,
+// it fails if the file is not a socket or another process is listening on it.
+func (e *Engine) RunUnix(file string) error {
+	server := e.newServer(file)
+	var created os.FileInfo
+	listen := func() (net.Listener, error) {
+		if err := removeStaleSocket(file); err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", file)
+		if err != nil {
+			return nil, err
+		}
+		// removed below only if it is still ours
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		created, _ = os.Lstat(file)
+		return listener, nil
+	}
+	defer func() {
+		// the file may have been replaced by another process after we listened
+		if info, err := os.Lstat(file); err == nil && created != nil && os.SameFile(info, created) {
+			_ = os.Remove(file)
+		}
+	}()
+	return e.run(server, listen, server.Serve)
+}
+
+var (
+	notSocketError   = errors.New("file exists and is not a socket")
+	socketInUseError = errors.New("socket is in use")
+)
+
+func removeStaleSocket(file string) error {
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("regia: %s: %w", file, notSocketError)
+	}
+	if conn, err := net.DialTimeout("unix", file, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("regia: %s: %w", file, socketInUseError)
+	}
+	return os.Remove(file)
+}
+
+// RunListener serves on the listener, such as the one inherited by socket activation
+//
+//	listener, _ := net.FileListener(os.NewFile(3, "socket"))
+//	engine.RunListener(listener)
+func (e *Engine) RunListener(listener net.Listener) error {
+	server := e.newServer(listener.Addr().String())
+	listen := func() (net.Listener, error) { return listener, nil }
+	return e.run(server, listen, server.Serve)
+}
+
+// SelfSignedCertificate generates a certificate for development, it is valid for one year.
+// The hosts can be domains or IPs, default `localhost` and `127.0.0.1`
+//
+//	cert, _ := regia.SelfSignedCertificate()
+//	engine.RunTLS(":8443", "", "", &tls.Config{Certificates: []tls.Certificate{cert}})
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Regia Development"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+var listenerClosedError = errors.New("use of closed network connection")
+
+// limitListener accepts at most n connections at the same time
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newLimitListener(listener net.Listener, n int) net.Listener {
+	return &limitListener{Listener: listener, slots: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, listenerClosedError
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+type limitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
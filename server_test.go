@@ -0,0 +1,355 @@
+package regia
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runEngine serves the engine on a local listener until the test ends
+func runEngine(t *testing.T, engine *Engine) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- engine.RunListener(listener) }()
+	t.Cleanup(func() {
+		engine.Shutdown()
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("RunListener: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("the engine did not shut down")
+		}
+	})
+	return "http://" + listener.Addr().String()
+}
+
+func h2cClient() *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: protocols}}
+}
+
+func TestH2C(t *testing.T) {
+	engine := New()
+	engine.H2C = true
+	engine.GET("/proto", func(ctx *Context) {
+		_, _ = ctx.Response.String("%s", ctx.Raw.Request.Proto)
+	})
+	url := runEngine(t, engine)
+
+	client := h2cClient()
+	resp, err := client.Get(url + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Fatalf("response %s, handler saw %q", resp.Proto, body)
+	}
+
+	// HTTP/1.1 is still served
+	resp, err = http.Get(url + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("HTTP/1.1 client got %s", resp.Proto)
+	}
+
+}
+
+func TestH2CDisabled(t *testing.T) {
+	engine := New()
+	engine.GET("/", func(ctx *Context) {})
+	url := runEngine(t, engine)
+	if resp, err := h2cClient().Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatalf("h2c is served without Engine.H2C, %s", resp.Proto)
+	}
+}
+
+func TestPushNotSupported(t *testing.T) {
+	engine := New()
+	var pushErr error
+	engine.GET("/", func(ctx *Context) { pushErr = ctx.Response.Push("/app.js") })
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !errors.Is(pushErr, http.ErrNotSupported) {
+		t.Fatalf("Push over HTTP/1.1 = %v", pushErr)
+	}
+}
+
+func unixClient(file string) *http.Client {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", file)
+	}
+	return &http.Client{Transport: &http.Transport{DialContext: dial}}
+}
+
+// runUnix serves the engine on the socket file until it answers, the returned function shuts it down
+func runUnix(t *testing.T, engine *Engine, file string) func() error {
+	t.Helper()
+	errs := make(chan error, 1)
+	go func() { errs <- engine.RunUnix(file) }()
+	client := unixClient(file)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if resp, err := client.Get("http://unix/"); err == nil {
+			_ = resp.Body.Close()
+			break
+		}
+		select {
+		case err := <-errs:
+			t.Fatalf("RunUnix: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the engine did not listen")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() error {
+		engine.Shutdown()
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("the engine did not shut down")
+			return nil
+		}
+	}
+}
+
+func TestRunUnix(t *testing.T) {
+	dir := t.TempDir()
+	newEngine := func() *Engine {
+		engine := New()
+		engine.GET("/", func(ctx *Context) { _, _ = ctx.Response.String("unix") })
+		return engine
+	}
+
+	t.Run("stale socket", func(t *testing.T) {
+		file := filepath.Join(dir, "stale.sock")
+		listener, err := net.Listen("unix", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		_ = listener.Close()
+
+		shutdown := runUnix(t, newEngine(), file)
+		resp, err := unixClient(file).Get("http://unix/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != "unix" {
+			t.Fatalf("body = %q", body)
+		}
+		if err := shutdown(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(file); !os.IsNotExist(err) {
+			t.Fatalf("socket not removed: %v", err)
+		}
+	})
+
+	t.Run("not a socket", func(t *testing.T) {
+		file := filepath.Join(dir, "data.txt")
+		if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := newEngine().RunUnix(file); !errors.Is(err, notSocketError) {
+			t.Fatalf("RunUnix = %v", err)
+		}
+		if data, err := os.ReadFile(file); err != nil || string(data) != "keep" {
+			t.Fatalf("file = %q, %v", data, err)
+		}
+	})
+
+	t.Run("in use", func(t *testing.T) {
+		file := filepath.Join(dir, "used.sock")
+		listener, err := net.Listen("unix", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}()
+		if err := newEngine().RunUnix(file); !errors.Is(err, socketInUseError) {
+			t.Fatalf("RunUnix = %v", err)
+		}
+		if _, err := os.Lstat(file); err != nil {
+			t.Fatalf("socket in use removed: %v", err)
+		}
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		file := filepath.Join(dir, "replaced.sock")
+		shutdown := runUnix(t, newEngine(), file)
+		// another process takes over the path
+		if err := os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+		listener, err := net.Listen("unix", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		if err := shutdown(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Lstat(file); err != nil {
+			t.Fatalf("socket of the other process removed: %v", err)
+		}
+	})
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := newLimitListener(inner, 2)
+	accepted := make(chan net.Conn, 3)
+	acceptErr := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				acceptErr <- err
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+	receive := func() net.Conn {
+		t.Helper()
+		select {
+		case conn := <-accepted:
+			return conn
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection not accepted")
+			return nil
+		}
+	}
+	first, _ := receive(), receive()
+
+	// the third connection waits for a free slot
+	select {
+	case <-accepted:
+		t.Fatal("accepted more than 2 connections")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// closing twice releases one slot only
+	_ = first.Close()
+	_ = first.Close()
+	third := receive()
+	defer third.Close()
+	select {
+	case <-accepted:
+		t.Fatal("accepted more than 2 connections")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the blocked Accept returns after the listener is closed
+	_ = listener.Close()
+	select {
+	case err := <-acceptErr:
+		if err == nil {
+			t.Fatal("Accept returned no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept blocked after Close")
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	release := make(chan struct{})
+	engine := New()
+	engine.MaxConnections = 1
+	engine.GET("/slow", func(ctx *Context) {
+		<-release
+		_, _ = ctx.Response.String("slow")
+	})
+	engine.GET("/", func(ctx *Context) { _, _ = ctx.Response.String("fast") })
+	base := runEngine(t, engine)
+
+	slow := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		slow <- err
+	}()
+	// wait for the slow request to hold the only connection
+	time.Sleep(100 * time.Millisecond)
+	fast := make(chan string, 1)
+	go func() {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(base + "/")
+		if err != nil {
+			fast <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		fast <- string(body)
+	}()
+	select {
+	case body := <-fast:
+		t.Fatalf("second connection served while the first is open: %q", body)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	http.DefaultClient.CloseIdleConnections()
+	select {
+	case body := <-fast:
+		if body != "fast" {
+			t.Fatalf("second request = %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second connection not served after the first closed")
+	}
+}
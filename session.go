@@ -0,0 +1,420 @@
+package regia
+
+import (
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionDataKey       = "regia.session"
+	sessionFlashPrefix   = "_flash."
+	defaultSessionCookie = "regia_session"
+	defaultSessionMaxAge = 24 * time.Hour
+	sessionSweepInterval = time.Minute
+)
+
+var invalidSessionIDError = errors.New("invalid session id")
+
+func init() {
+	// flashes are stored as []interface{}
+	gob.Register([]interface{}{})
+}
+
+// SessionStore is used to persist the session values
+type SessionStore interface {
+	// Load returns nil values without error if the session does not exist or is expired
+	Load(id string) (map[string]interface{}, error)
+	Save(id string, values map[string]interface{}, ttl time.Duration) error
+	Delete(id string) error
+}
+
+// SessionOptions configures the session cookie
+type SessionOptions struct {
+	// default `regia_session`
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+
+	// lifetime of both cookie and stored values
+	// default 24 hours
+	MaxAge time.Duration
+}
+
+// SessionMiddleware loads the session keyed by a signed cookie before
+// the rest handlers and saves it after them.
+// Engine.Keyring must be set to sign the cookie.
+func SessionMiddleware(store SessionStore, options SessionOptions) HandleFunc {
+	if options.CookieName == "" {
+		options.CookieName = defaultSessionCookie
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = defaultSessionMaxAge
+	}
+	return func(ctx *Context) {
+		if ctx.Engine.Keyring == nil {
+			panic("session middleware needs Engine.Keyring")
+		}
+		session := &Session{store: store, options: options, ctx: ctx}
+		if cookie, err := ctx.Request.GetSignedCookie(options.CookieName); err == nil {
+			if values, err := store.Load(cookie.Value); err == nil && values != nil {
+				session.id, session.values = cookie.Value, values
+			}
+		}
+		if session.id == "" {
+			session.id = newSessionID()
+			session.values = make(map[string]interface{})
+		}
+		// the cookie must be written before the body, refresh it here
+		session.setCookie(options.MaxAge)
+		ctx.Data.Set(sessionDataKey, session)
+		defer func() {
+			if !session.saved {
+				_ = session.Save()
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// Session holds the values of one client among requests
+type Session struct {
+	id       string
+	values   map[string]interface{}
+	store    SessionStore
+	options  SessionOptions
+	ctx      *Context
+	modified bool
+	saved    bool
+	mu       sync.RWMutex
+}
+
+func (s *Session) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.id
+}
+
+func (s *Session) Get(key string) (value interface{}, exist bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, exist = s.values[key]
+	return
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.modified = true
+}
+
+// Clear removes all values of the session
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]interface{})
+	s.modified = true
+}
+
+// Flash adds a value which will be removed after reading by Flashes
+func (s *Session) Flash(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, _ := s.values[sessionFlashPrefix+key].([]interface{})
+	s.values[sessionFlashPrefix+key] = append(flashes, value)
+	s.modified = true
+}
+
+// Flashes returns and removes the flash values of the key
+func (s *Session) Flashes(key string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, exist := s.values[sessionFlashPrefix+key]
+	if !exist {
+		return nil
+	}
+	delete(s.values, sessionFlashPrefix+key)
+	s.modified = true
+	values, _ := flashes.([]interface{})
+	return values
+}
+
+// Regenerate moves the values to a new session id and deletes the old one,
+// call it after login to prevent session fixation.
+// It writes the cookie, so call it before writing the body.
+func (s *Session) Regenerate() error {
+	s.mu.Lock()
+	old := s.id
+	s.id = newSessionID()
+	s.modified = true
+	s.mu.Unlock()
+	if err := s.store.Delete(old); err != nil {
+		return err
+	}
+	s.setCookie(s.options.MaxAge)
+	return nil
+}
+
+// Destroy deletes the session from both store and client
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	s.values = make(map[string]interface{})
+	s.saved = true
+	s.mu.Unlock()
+	s.setCookie(-1)
+	return s.store.Delete(s.ID())
+}
+
+// Save persists the session, it will be called automatically
+// after the handlers if it has not been called
+func (s *Session) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = true
+	// do not store empty sessions which were never touched
+	if !s.modified && len(s.values) == 0 {
+		return nil
+	}
+	return s.store.Save(s.id, s.values, s.options.MaxAge)
+}
+
+func (s *Session) setCookie(maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     s.options.CookieName,
+		Value:    s.ID(),
+		Path:     s.options.Path,
+		Domain:   s.options.Domain,
+		Secure:   s.options.Secure,
+		SameSite: s.options.SameSite,
+		HttpOnly: true,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge / time.Second)
+		cookie.Expires = time.Now().Add(maxAge)
+	}
+	// Regenerate and Destroy replace the cookie written by the middleware,
+	// a response must not carry two cookies of the same name
+	header := s.ctx.Response.Header()
+	var kept []string
+	for _, line := range header["Set-Cookie"] {
+		if !strings.HasPrefix(line, s.options.CookieName+"=") {
+			kept = append(kept, line)
+		}
+	}
+	header["Set-Cookie"] = kept
+	_ = s.ctx.Response.SetSignedCookie(cookie)
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func copySessionValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+type memorySession struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+// MemorySessionStore keeps sessions in memory,
+// the expired sessions are evicted while saving
+type MemorySessionStore struct {
+	items     map[string]memorySession
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{items: make(map[string]memorySession)}
+}
+
+func (m *MemorySessionStore) Load(id string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, exist := m.items[id]
+	if !exist {
+		return nil, nil
+	}
+	if time.Now().After(item.expires) {
+		delete(m.items, id)
+		return nil, nil
+	}
+	return copySessionValues(item.values), nil
+}
+
+func (m *MemorySessionStore) Save(id string, values map[string]interface{}, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastSweep) > sessionSweepInterval {
+		for key, item := range m.items {
+			if now.After(item.expires) {
+				delete(m.items, key)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.items[id] = memorySession{values: copySessionValues(values), expires: now.Add(ttl)}
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, id)
+	return nil
+}
+
+// Len returns the count of stored sessions, the expired ones may be included
+func (m *MemorySessionStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+type fileSession struct {
+	Values  map[string]interface{}
+	Expires time.Time
+}
+
+// FileSessionStore keeps every session as a gob encoded file in Dir,
+// register your own types with gob.Register before storing them
+type FileSessionStore struct {
+	Dir       string
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{Dir: dir}, nil
+}
+
+func (f *FileSessionStore) path(id string) (string, error) {
+	// session ids are hex strings, reject anything else to keep the path inside Dir
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", invalidSessionIDError
+	}
+	return filepath.Join(f.Dir, id+".session"), nil
+}
+
+func (f *FileSessionStore) read(path string) (*fileSession, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	session := new(fileSession)
+	if err := gob.NewDecoder(file).Decode(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (f *FileSessionStore) Load(id string) (map[string]interface{}, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	session, err := f.read(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.Expires) {
+		_ = os.Remove(path)
+		return nil, nil
+	}
+	if session.Values == nil {
+		session.Values = make(map[string]interface{})
+	}
+	return session.Values, nil
+}
+
+func (f *FileSessionStore) Save(id string, values map[string]interface{}, ttl time.Duration) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	f.sweep()
+	// a temp file per writer, the concurrent requests of a session may save at the same time
+	tmp, err := os.CreateTemp(f.Dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(tmp).Encode(fileSession{Values: values, Expires: time.Now().Add(ttl)})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileSessionStore) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// remove the expired session files at most once per sweep interval
+func (f *FileSessionStore) sweep() {
+	f.mu.Lock()
+	now := time.Now()
+	if now.Sub(f.lastSweep) < sessionSweepInterval {
+		f.mu.Unlock()
+		return
+	}
+	f.lastSweep = now
+	f.mu.Unlock()
+	paths, _ := filepath.Glob(filepath.Join(f.Dir, "*.session"))
+	for _, path := range paths {
+		if session, err := f.read(path); err == nil && now.After(session.Expires) {
+			_ = os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package regia
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sessionClient struct {
+	t      *testing.T
+	engine *Engine
+	cookie *http.Cookie
+}
+
+// get sends the cookie of the last response and returns the body and the Set-Cookie lines
+func (c *sessionClient) get(path string) (string, []string) {
+	c.t.Helper()
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if c.cookie != nil {
+		request.AddCookie(c.cookie)
+	}
+	recorder := httptest.NewRecorder()
+	c.engine.ServeHTTP(recorder, request)
+	if cookies := recorder.Result().Cookies(); len(cookies) > 0 {
+		c.cookie = cookies[len(cookies)-1]
+	}
+	return recorder.Body.String(), recorder.Header()["Set-Cookie"]
+}
+
+func newSessionEngine(t *testing.T, store SessionStore) *sessionClient {
+	t.Helper()
+	engine := New()
+	engine.Keyring = newTestKeyring(t, "secret")
+	engine.Use(SessionMiddleware(store, SessionOptions{}))
+	engine.GET("/set", func(ctx *Context) {
+		ctx.Session().Set("user", ctx.Request.Query().Get("user").String())
+	})
+	engine.GET("/get", func(ctx *Context) {
+		user, _ := ctx.Session().Get("user")
+		_, _ = ctx.Response.String("%v", user)
+	})
+	engine.GET("/flash", func(ctx *Context) { ctx.Session().Flash("msg", "saved") })
+	engine.GET("/flashes", func(ctx *Context) {
+		_, _ = ctx.Response.String("%v", ctx.Session().Flashes("msg"))
+	})
+	engine.GET("/regenerate", func(ctx *Context) {
+		if err := ctx.Session().Regenerate(); err != nil {
+			t.Error(err)
+		}
+		_, _ = ctx.Response.String("%s", ctx.Session().ID())
+	})
+	engine.GET("/destroy", func(ctx *Context) {
+		if err := ctx.Session().Destroy(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	return &sessionClient{t: t, engine: engine}
+}
+
+func testSessionMiddleware(t *testing.T, store SessionStore) {
+	client := newSessionEngine(t, store)
+	if _, cookies := client.get("/set?user=alice"); len(cookies) != 1 {
+		t.Fatalf("Set-Cookie = %v", cookies)
+	}
+	if body, _ := client.get("/get"); body != "alice" {
+		t.Fatalf("user = %q", body)
+	}
+
+	client.get("/flash")
+	if body, _ := client.get("/flashes"); body != "[saved]" {
+		t.Fatalf("flashes = %q", body)
+	}
+	if body, _ := client.get("/flashes"); body != "[]" {
+		t.Fatalf("flashes read twice = %q", body)
+	}
+
+	old := *client.cookie
+	oldID, _ := client.engine.Keyring.Verify(old.Name, old.Value)
+	id, cookies := client.get("/regenerate")
+	if len(cookies) != 1 {
+		t.Fatalf("Regenerate sent %d cookies: %v", len(cookies), cookies)
+	}
+	if id == oldID {
+		t.Fatal("the session id is not changed")
+	}
+	if cookieID, _ := client.engine.Keyring.Verify(client.cookie.Name, client.cookie.Value); cookieID != id {
+		t.Fatalf("the cookie carries %q, the session is %q", cookieID, id)
+	}
+	if body, _ := client.get("/get"); body != "alice" {
+		t.Fatalf("user after Regenerate = %q", body)
+	}
+	if values, _ := store.Load(oldID); values != nil {
+		t.Fatalf("the old session is kept: %v", values)
+	}
+
+	// the fixed session id is not accepted
+	current := client.cookie
+	client.cookie = &old
+	if body, _ := client.get("/get"); body != "<nil>" {
+		t.Fatalf("the old cookie got %q", body)
+	}
+	client.cookie = current
+
+	_, cookies = client.get("/destroy")
+	if len(cookies) != 1 || client.cookie.MaxAge != -1 {
+		t.Fatalf("Destroy sent %v", cookies)
+	}
+	if values, _ := store.Load(id); values != nil {
+		t.Fatalf("the destroyed session is kept: %v", values)
+	}
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testSessionMiddleware(t, NewMemorySessionStore()) })
+	t.Run("file", func(t *testing.T) {
+		store, err := NewFileSessionStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testSessionMiddleware(t, store)
+	})
+}
+
+func TestSessionTamperedCookie(t *testing.T) {
+	store := NewMemorySessionStore()
+	client := newSessionEngine(t, store)
+	client.get("/set?user=alice")
+	client.cookie.Value = tamper(client.cookie.Value)
+	if body, _ := client.get("/get"); body != "<nil>" {
+		t.Fatalf("tampered cookie got %q", body)
+	}
+	// the untouched empty session is not stored
+	if n := store.Len(); n != 1 {
+		t.Fatalf("stored %d sessions", n)
+	}
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	id := newSessionID()
+	if values, err := store.Load(id); values != nil || err != nil {
+		t.Fatalf("Load of a missing session = %v, %v", values, err)
+	}
+	if err := store.Save(id, map[string]interface{}{"user": "alice", "flash": []interface{}{"x"}}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	values, err := store.Load(id)
+	if err != nil || values["user"] != "alice" || len(values["flash"].([]interface{})) != 1 {
+		t.Fatalf("Load = %v, %v", values, err)
+	}
+	if err := store.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := store.Load(id); values != nil {
+		t.Fatalf("Load of a deleted session = %v", values)
+	}
+	if err := store.Delete(id); err != nil {
+		t.Fatalf("Delete twice = %v", err)
+	}
+
+	expired := newSessionID()
+	if err := store.Save(expired, map[string]interface{}{"user": "bob"}, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := store.Load(expired); values != nil {
+		t.Fatalf("Load of an expired session = %v", values)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	testSessionStore(t, store)
+
+	// a stored value is not changed by the caller
+	id := newSessionID()
+	values := map[string]interface{}{"user": "alice"}
+	_ = store.Save(id, values, time.Hour)
+	values["user"] = "bob"
+	if loaded, _ := store.Load(id); loaded["user"] != "alice" {
+		t.Fatalf("Load = %v", loaded)
+	}
+
+	_ = store.Save(newSessionID(), nil, -time.Second)
+	store.lastSweep = time.Time{}
+	_ = store.Save(id, values, time.Hour)
+	if n := store.Len(); n != 1 {
+		t.Fatalf("%d sessions after sweeping", n)
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+
+	for _, id := range []string{"", "../secret", "zz"} {
+		if _, err := store.Load(id); err != invalidSessionIDError {
+			t.Errorf("Load(%q) = %v", id, err)
+		}
+		if err := store.Save(id, nil, time.Hour); err != invalidSessionIDError {
+			t.Errorf("Save(%q) = %v", id, err)
+		}
+	}
+
+	// concurrent requests of a session save at the same time
+	id := newSessionID()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.Save(id, map[string]interface{}{"n": i}, time.Hour); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if values, err := store.Load(id); err != nil || values["n"] == nil {
+		t.Fatalf("Load = %v, %v", values, err)
+	}
+	files, _ := os.ReadDir(dir)
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			t.Errorf("temp file %s is left", file.Name())
+		}
+	}
+
+	expired := newSessionID()
+	_ = store.Save(expired, nil, -time.Second)
+	store.lastSweep = time.Time{}
+	_ = store.Save(id, nil, time.Hour)
+	if _, err := os.Stat(filepath.Join(dir, expired+".session")); !os.IsNotExist(err) {
+		t.Fatalf("the expired session is not swept: %v", err)
+	}
+}
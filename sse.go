@@ -0,0 +1,352 @@
+package regia
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+	defaultSSEBufferSize   = 16
+	defaultSSEHeartbeat    = 15 * time.Second
+	lastEventIDHeader      = "Last-Event-ID"
+	lastEventIDQuery       = "lastEventId"
+)
+
+var (
+	streamingUnsupportedError = errors.New("streaming unsupported")
+
+	// SSEClosedError will be returned while writing to a closed or disconnected stream
+	SSEClosedError = errors.New("sse stream closed")
+)
+
+// SSEEvent is one message of Server-Sent Events
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// encode the event as the `text/event-stream` format
+func (e SSEEvent) encode() string {
+	var builder strings.Builder
+	if e.ID != "" {
+		builder.WriteString("id: " + cleanSSEField(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		builder.WriteString("event: " + cleanSSEField(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		builder.WriteString("retry: " + strconv.FormatInt(int64(e.Retry/time.Millisecond), 10) + "\n")
+	}
+	if e.Data != "" {
+		data := strings.Replace(e.Data, "\r\n", "\n", -1)
+		for _, line := range strings.Split(data, "\n") {
+			builder.WriteString("data: " + line + "\n")
+		}
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+func cleanSSEField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SSEStream writes Server-Sent Events to the client,
+// it is safe to write from multiple goroutines
+type SSEStream struct {
+	ctx     *Context
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	closed  bool
+	mu      sync.Mutex
+
+	// stop the heartbeats and wait for them in Close
+	stop       chan struct{}
+	stopOnce   sync.Once
+	heartbeats sync.WaitGroup
+}
+
+// SSE starts a Server-Sent Events stream
+func (r *Response) SSE() (*SSEStream, error) {
+	flusher, ok := r.ResponseWriter.(http.Flusher)
+	if !ok || !canFlush(r.ResponseWriter) {
+		return nil, streamingUnsupportedError
+	}
+	header := r.Header()
+	header.Set(contentType, eventStreamContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disable the buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	r.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	stream := &SSEStream{ctx: r.Context, writer: r.ResponseWriter, flusher: flusher, stop: make(chan struct{})}
+	r.streams = append(r.streams, stream)
+	return stream, nil
+}
+
+// Done is closed when the client disconnects
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Raw.Request.Context().Done()
+}
+
+// LastEventID returns the id of last event the client received before reconnecting,
+// it is read from the `Last-Event-ID` header or the `lastEventId` query
+func (s *SSEStream) LastEventID() string {
+	if id := s.ctx.Request.Header().Get(lastEventIDHeader).String(); id != "" {
+		return id
+	}
+	return s.ctx.Request.Query().Get(lastEventIDQuery).String()
+}
+
+// Send writes the event and flushes it
+func (s *SSEStream) Send(event SSEEvent) error {
+	return s.write(event.encode())
+}
+
+// Data writes a message without event name
+func (s *SSEStream) Data(data string) error {
+	return s.Send(SSEEvent{Data: data})
+}
+
+// Event writes a message with the event name
+func (s *SSEStream) Event(event, data string) error {
+	return s.Send(SSEEvent{Event: event, Data: data})
+}
+
+// Json writes a message with the event name and the data serialized by Engine.JsonSerializer
+func (s *SSEStream) Json(event string, v interface{}) error {
+	data, err := s.ctx.Engine.JsonSerializer.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(SSEEvent{Event: event, Data: string(data)})
+}
+
+// ID sets the last event id of the client
+func (s *SSEStream) ID(id string) error {
+	return s.Send(SSEEvent{ID: id})
+}
+
+// Retry sets the reconnection time of the client
+func (s *SSEStream) Retry(retry time.Duration) error {
+	return s.Send(SSEEvent{Retry: retry})
+}
+
+// Comment writes a comment line which is ignored by the client
+func (s *SSEStream) Comment(comment string) error {
+	return s.write(": " + cleanSSEField(comment) + "\n\n")
+}
+
+// Heartbeat writes a comment periodically to keep the connection alive
+// until the client disconnects or a write fails
+func (s *SSEStream) Heartbeat(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSSEHeartbeat
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.heartbeats.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.heartbeats.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.Done():
+				return
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the stream and waits for the Heartbeat to exit,
+// it is called after the handlers return, nothing can be written after that
+func (s *SSEStream) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.heartbeats.Wait()
+}
+
+func (s *SSEStream) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		select {
+		case <-s.Done():
+			s.closed = true
+		default:
+		}
+	}
+	if s.closed {
+		return SSEClosedError
+	}
+	if _, err := s.writer.Write([]byte(data)); err != nil {
+		s.closed = true
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// SSEBroker fans out the events to the subscribers of the topic in process
+type SSEBroker struct {
+	// Buffer size of every subscription, the events are dropped if it is full
+	// default 16
+	BufferSize int
+
+	// Count of recent events kept per topic for replaying by Last-Event-ID
+	// default 0 means no replay
+	History int
+
+	// Interval of the heartbeat comment in Serve, default 15 seconds
+	Heartbeat time.Duration
+
+	topics  map[string]map[*SSESubscription]struct{}
+	history map[string][]SSEEvent
+	mu      sync.RWMutex
+}
+
+func NewSSEBroker() *SSEBroker {
+	return &SSEBroker{}
+}
+
+// SSESubscription receives the events of topics
+type SSESubscription struct {
+	Events <-chan SSEEvent
+	events chan SSEEvent
+	topics []string
+	broker *SSEBroker
+	once   sync.Once
+}
+
+// Close unsubscribes all topics
+func (s *SSESubscription) Close() {
+	s.once.Do(func() {
+		b := s.broker
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, topic := range s.topics {
+			delete(b.topics[topic], s)
+			if len(b.topics[topic]) == 0 {
+				delete(b.topics, topic)
+			}
+		}
+	})
+}
+
+// Subscribe the topics, call Close after use
+func (b *SSEBroker) Subscribe(topics ...string) *SSESubscription {
+	size := b.BufferSize
+	if size <= 0 {
+		size = defaultSSEBufferSize
+	}
+	events := make(chan SSEEvent, size)
+	sub := &SSESubscription{Events: events, events: events, topics: topics, broker: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.topics == nil {
+		b.topics = make(map[string]map[*SSESubscription]struct{})
+	}
+	for _, topic := range topics {
+		if b.topics[topic] == nil {
+			b.topics[topic] = make(map[*SSESubscription]struct{})
+		}
+		b.topics[topic][sub] = struct{}{}
+	}
+	return sub
+}
+
+// Publish sends the event to all subscribers of the topic without blocking,
+// returns the count of subscribers received it
+func (b *SSEBroker) Publish(topic string, event SSEEvent) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.History > 0 {
+		if b.history == nil {
+			b.history = make(map[string][]SSEEvent)
+		}
+		history := append(b.history[topic], event)
+		if len(history) > b.History {
+			history = history[len(history)-b.History:]
+		}
+		b.history[topic] = history
+	}
+	count := 0
+	for sub := range b.topics[topic] {
+		select {
+		case sub.events <- event:
+			count++
+		default:
+			// slow subscriber, drop the event
+		}
+	}
+	return count
+}
+
+// returns the kept events after the id, nil if the id is not found
+func (b *SSEBroker) replay(topics []string, id string) []SSEEvent {
+	if id == "" {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var events []SSEEvent
+	for _, topic := range topics {
+		history := b.history[topic]
+		for i := range history {
+			if history[i].ID == id {
+				events = append(events, history[i+1:]...)
+				break
+			}
+		}
+	}
+	return events
+}
+
+// Serve streams the events of topics to the client until it disconnects,
+// the missed events are replayed if the client reconnects with Last-Event-ID
+func (b *SSEBroker) Serve(ctx *Context, topics ...string) error {
+	stream, err := ctx.Response.SSE()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	sub := b.Subscribe(topics...)
+	defer sub.Close()
+	for _, event := range b.replay(topics, stream.LastEventID()) {
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+	stream.Heartbeat(b.Heartbeat)
+	for {
+		select {
+		case <-stream.Done():
+			return nil
+		case event := <-sub.Events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package regia
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSEEventEncode(t *testing.T) {
+	tests := []struct {
+		event    SSEEvent
+		expected string
+	}{
+		{SSEEvent{Data: "hello"}, "data: hello\n\n"},
+		{SSEEvent{ID: "1", Event: "news", Data: "a\r\nb\nc"}, "id: 1\nevent: news\ndata: a\ndata: b\ndata: c\n\n"},
+		{SSEEvent{ID: "1\n2", Event: "a\rb"}, "id: 12\nevent: ab\n\n"},
+		{SSEEvent{Retry: 1500 * time.Millisecond}, "retry: 1500\n\n"},
+	}
+	for _, test := range tests {
+		if encoded := test.event.encode(); encoded != test.expected {
+			t.Errorf("encode(%+v) = %q", test.event, encoded)
+		}
+	}
+}
+
+// syncRecorder is a flushable recorder safe to read while the handler writes
+type syncRecorder struct {
+	*httptest.ResponseRecorder
+	mu sync.Mutex
+}
+
+func (s *syncRecorder) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseRecorder.Write(b)
+}
+
+func (s *syncRecorder) body() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Body.String()
+}
+
+func TestSSEStream(t *testing.T) {
+	engine := New()
+	var stream *SSEStream
+	engine.GET("/events", func(ctx *Context) {
+		var err error
+		if stream, err = ctx.Response.SSE(); err != nil {
+			t.Fatal(err)
+		}
+		_ = stream.Retry(time.Second)
+		_ = stream.Json("user", Map{"name": "alice"})
+		_ = stream.Comment("note")
+		stream.Heartbeat(time.Millisecond)
+		// the heartbeat writes in the background
+		time.Sleep(20 * time.Millisecond)
+		// return without Close
+	})
+	recorder := &syncRecorder{ResponseRecorder: httptest.NewRecorder()}
+	request := httptest.NewRequest(http.MethodGet, "/events?lastEventId=7", nil)
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	engine.ServeHTTP(recorder, request)
+
+	body := recorder.body()
+	header := recorder.Header()
+	if header.Get(contentType) != eventStreamContentType || header.Get("Cache-Control") != "no-cache" || header.Get("X-Accel-Buffering") != "no" {
+		t.Fatalf("header = %v", header)
+	}
+	expected := "retry: 1000\n\nevent: user\ndata: {\"name\":\"alice\"}\n\n: note\n\n: heartbeat\n\n"
+	if !strings.HasPrefix(body, expected) {
+		t.Fatalf("body = %q", body)
+	}
+	if stream.LastEventID() != "7" {
+		t.Fatalf("LastEventID = %q", stream.LastEventID())
+	}
+
+	// nothing is written after the handler returns
+	time.Sleep(20 * time.Millisecond)
+	if after := recorder.body(); after != body {
+		t.Fatalf("written after the handler returned: %q", after[len(body):])
+	}
+	if err := stream.Data("late"); err != SSEClosedError {
+		t.Fatalf("Data after the handler returned = %v", err)
+	}
+}
+
+type noFlushWriter struct{ http.ResponseWriter }
+
+func TestSSEUnsupported(t *testing.T) {
+	engine := New()
+	var sseErr error
+	engine.GET("/events", func(ctx *Context) { _, sseErr = ctx.Response.SSE() })
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	engine.ServeHTTP(noFlushWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if sseErr != streamingUnsupportedError {
+		t.Fatalf("SSE on a writer can not flush = %v", sseErr)
+	}
+}
+
+func TestSSEBroker(t *testing.T) {
+	broker := NewSSEBroker()
+	broker.BufferSize = 1
+	broker.History = 2
+	sub := broker.Subscribe("a", "b")
+	if n := broker.Publish("a", SSEEvent{ID: "1", Data: "one"}); n != 1 {
+		t.Fatalf("Publish = %d", n)
+	}
+	// the full subscription drops the event
+	if n := broker.Publish("b", SSEEvent{ID: "2", Data: "two"}); n != 0 {
+		t.Fatalf("Publish to a full subscription = %d", n)
+	}
+	if event := <-sub.Events; event.Data != "one" {
+		t.Fatalf("received %+v", event)
+	}
+	sub.Close()
+	sub.Close()
+	if n := broker.Publish("a", SSEEvent{ID: "3", Data: "three"}); n != 0 {
+		t.Fatalf("Publish after Close = %d", n)
+	}
+	broker.Publish("a", SSEEvent{ID: "4", Data: "four"})
+
+	// replay the kept events after Last-Event-ID
+	engine := New()
+	engine.GET("/events", func(ctx *Context) { _ = broker.Serve(ctx, "a") })
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	request.Header.Set(lastEventIDHeader, "3")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	if event := readEvent(); event != "id: 4\ndata: four\n" {
+		t.Fatalf("replayed %q", event)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.topics["a"]) == 1
+	})
+	broker.Publish("a", SSEEvent{Event: "news", Data: "live"})
+	if event := readEvent(); event != "event: news\ndata: live\n" {
+		t.Fatalf("received %q", event)
+	}
+
+	// unsubscribed after the client disconnects
+	cancel()
+	waitFor(t, 5*time.Second, func() bool {
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
+		return len(broker.topics) == 0
+	})
+}
@@ -1,27 +1,167 @@
 package regia
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
 
-var title = formatColor("[REGIA URL INFO]", 96)
+// StartPhase is the moment a Starter runs
+type StartPhase int
 
-// Starter will be called while engine is running
+const (
+	// Before the handles are registered to the router
+	BeforeRoutes StartPhase = iota
+
+	// After the handles are registered, it is the default phase
+	AfterRoutes
+
+	// After the listener is bound, Engine.Addr is available
+	AfterListen
+)
+
+var starterCycleError = errors.New("circular dependency")
+
+// Starter will be called while engine is running,
+// Engine.Run aborts if it returns an error
 type Starter interface {
-	Start(engine *Engine)
+	Start(engine *Engine) error
+}
+
+// PhaseStarter is a Starter runs in the specified phase
+type PhaseStarter interface {
+	Phase() StartPhase
+}
+
+// NamedStarter is a Starter can be depended by name
+type NamedStarter interface {
+	Name() string
+}
+
+// DependentStarter is a Starter runs after the starters it depends on
+type DependentStarter interface {
+	DependsOn() []string
 }
 
+// Stopper will be called after engine shut down or failed to start
+type Stopper interface {
+	Stop(engine *Engine)
+}
+
+func starterName(starter Starter) string {
+	if named, ok := starter.(NamedStarter); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", starter)
+}
+
+func starterPhase(starter Starter) StartPhase {
+	if phased, ok := starter.(PhaseStarter); ok {
+		return phased.Phase()
+	}
+	return AfterRoutes
+}
+
+// reports whether the value is one of the starters,
+// the values of unhashable types are never equal to others
+func containsStarter(starters []Starter, value interface{}) bool {
+	typ := reflect.TypeOf(value)
+	if typ == nil || !typ.Comparable() {
+		return false
+	}
+	for _, starter := range starters {
+		if reflect.TypeOf(starter) == typ && interface{}(starter) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the starters of the phase, the dependencies come first.
+// The starters are tracked by index, they may be values of unhashable types
+func orderStarters(starters []Starter, phase StartPhase) ([]Starter, error) {
+	named := make(map[string]int)
+	for i, starter := range starters {
+		if n, ok := starter.(NamedStarter); ok {
+			if _, exist := named[n.Name()]; exist {
+				return nil, fmt.Errorf("regia: duplicate starter name %q", n.Name())
+			}
+			named[n.Name()] = i
+		}
+	}
+	const visiting, visited = 1, 2
+	states := make([]int, len(starters))
+	var ordered []Starter
+	var visit func(i int) error
+	visit = func(i int) error {
+		starter := starters[i]
+		switch states[i] {
+		case visiting:
+			return fmt.Errorf("regia: starter %s: %w", starterName(starter), starterCycleError)
+		case visited:
+			return nil
+		}
+		states[i] = visiting
+		if dependent, ok := starter.(DependentStarter); ok {
+			for _, name := range dependent.DependsOn() {
+				index, exist := named[name]
+				if !exist {
+					return fmt.Errorf("regia: starter %s depends on missing starter %q", starterName(starter), name)
+				}
+				dependency := starters[index]
+				if starterPhase(dependency) > starterPhase(starter) {
+					return fmt.Errorf("regia: starter %s depends on %q of a later phase", starterName(starter), name)
+				}
+				// the dependency of an earlier phase has run
+				if starterPhase(dependency) < phase {
+					continue
+				}
+				if err := visit(index); err != nil {
+					return err
+				}
+			}
+		}
+		states[i] = visited
+		ordered = append(ordered, starter)
+		return nil
+	}
+	for i, starter := range starters {
+		if starterPhase(starter) != phase {
+			continue
+		}
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// BannerStarter prints the banner if the engine logs to a terminal,
+// files and log collectors get a plain `starting` line instead of the multi-line art
 type BannerStarter struct{ Banner string }
 
-func (b *BannerStarter) Start(engine *Engine) { fmt.Print(b.Banner) }
+func (b *BannerStarter) Start(engine *Engine) error {
+	if logger, ok := engine.Logger.(*StdLogger); ok && logger.Level <= InfoLevel && IsTerminal(logger.Writer) {
+		logger.write([]byte(b.Banner))
+		return nil
+	}
+	engine.Logger.Info("starting")
+	return nil
+}
 
+// UrlInfoStarter logs the routes and the address after the listener is bound
 type UrlInfoStarter struct{}
 
-func (u *UrlInfoStarter) Start(engine *Engine) {
+func (u *UrlInfoStarter) Phase() StartPhase { return AfterListen }
+
+func (u *UrlInfoStarter) Start(engine *Engine) error {
 	for method, nodes := range engine.GetMethodTree() {
-		m := formatColor(method, 97)
 		for _, n := range nodes {
-			handleCount := formatColor(fmt.Sprintf("%d handlers", len(n.group)), colorBlue)
-			path := formatColor(n.path, colorYellow)
-			fmt.Printf("%-15s   %-18s   %-18s   %s\n", title, m, handleCount, path)
+			engine.Logger.Info("route", F("method", method), F("path", n.path), F("handlers", len(n.group)))
 		}
 	}
+	if addr := engine.Addr(); addr != nil {
+		engine.Logger.Info("listening", F("addr", addr.String()))
+	}
+	return nil
 }
@@ -0,0 +1,161 @@
+package regia
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStarter is a value with a slice field, it is not hashable
+type testStarter struct {
+	name      string
+	phase     StartPhase
+	dependsOn []string
+	log       *[]string
+}
+
+func (s testStarter) Start(*Engine) error {
+	*s.log = append(*s.log, s.name)
+	return nil
+}
+
+func (s testStarter) Name() string { return s.name }
+
+func (s testStarter) Phase() StartPhase { return s.phase }
+
+func (s testStarter) DependsOn() []string { return s.dependsOn }
+
+func TestOrderStarters(t *testing.T) {
+	var log []string
+	starters := []Starter{
+		testStarter{name: "web", phase: AfterRoutes, dependsOn: []string{"cache", "db"}, log: &log},
+		testStarter{name: "cache", phase: AfterRoutes, dependsOn: []string{"db"}, log: &log},
+		testStarter{name: "db", phase: BeforeRoutes, log: &log},
+		testStarter{name: "banner", phase: AfterListen, log: &log},
+		testStarter{name: "config", phase: BeforeRoutes, log: &log},
+	}
+	expected := map[StartPhase][]string{
+		BeforeRoutes: {"db", "config"},
+		AfterRoutes:  {"cache", "web"},
+		AfterListen:  {"banner"},
+	}
+	for phase, names := range expected {
+		log = nil
+		ordered, err := orderStarters(starters, phase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, starter := range ordered {
+			_ = starter.Start(nil)
+		}
+		if !reflect.DeepEqual(log, names) {
+			t.Errorf("phase %d ran %v, want %v", phase, log, names)
+		}
+	}
+}
+
+func TestOrderStartersErrors(t *testing.T) {
+	var log []string
+	cases := []struct {
+		starters []Starter
+		message  string
+	}{
+		{[]Starter{
+			testStarter{name: "a", dependsOn: []string{"b"}, log: &log},
+			testStarter{name: "b", dependsOn: []string{"a"}, log: &log},
+		}, "circular dependency"},
+		{[]Starter{testStarter{name: "a", dependsOn: []string{"missing"}, log: &log}}, `missing starter "missing"`},
+		{[]Starter{testStarter{name: "a", log: &log}, testStarter{name: "a", log: &log}}, `duplicate starter name "a"`},
+		{[]Starter{
+			testStarter{name: "a", dependsOn: []string{"b"}, log: &log},
+			testStarter{name: "b", phase: AfterListen, log: &log},
+		}, "later phase"},
+	}
+	for _, c := range cases {
+		_, err := orderStarters(c.starters, BeforeRoutes)
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("error = %v, want %q", err, c.message)
+		}
+	}
+	_, err := orderStarters(cases[0].starters, BeforeRoutes)
+	if !errors.Is(err, starterCycleError) {
+		t.Errorf("error = %v, want starterCycleError", err)
+	}
+}
+
+func TestEngineRunsUnhashableStarter(t *testing.T) {
+	var log []string
+	engine := New()
+	engine.AddStarter(testStarter{name: "value", log: &log})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(log, []string{"value"}) {
+		t.Fatalf("ran %v", log)
+	}
+}
+
+// the multi-line banner must not end up as an escaped msg in logfmt or JSON
+func TestBannerStarterNotTerminal(t *testing.T) {
+	buffer := &strings.Builder{}
+	engine := New()
+	engine.Logger = NewLogger(buffer)
+	if err := (&BannerStarter{Banner: Banner}).Start(engine); err != nil {
+		t.Fatal(err)
+	}
+	line := buffer.String()
+	if strings.Count(line, "\n") != 1 || !strings.Contains(line, "msg=starting") {
+		t.Fatalf("logged %q", line)
+	}
+}
+
+// lifecycle is a starter and stopper recording both calls
+type lifecycle struct {
+	name  string
+	phase StartPhase
+	err   error
+	log   *[]string
+}
+
+func (l *lifecycle) Start(*Engine) error {
+	*l.log = append(*l.log, "start "+l.name)
+	return l.err
+}
+
+func (l *lifecycle) Stop(*Engine) { *l.log = append(*l.log, "stop "+l.name) }
+
+func (l *lifecycle) Phase() StartPhase { return l.phase }
+
+type stopFunc func(*Engine)
+
+func (f stopFunc) Stop(engine *Engine) { f(engine) }
+
+func TestStarterFailureStopsStarted(t *testing.T) {
+	var log []string
+	db := &lifecycle{name: "db", phase: BeforeRoutes, log: &log}
+	cache := &lifecycle{name: "cache", log: &log}
+	broken := &lifecycle{name: "broken", err: errors.New("boom"), log: &log}
+	hub := &lifecycle{name: "hub", log: &log}
+	listen := &lifecycle{name: "listen", phase: AfterListen, log: &log}
+	engine := New()
+	engine.Logger = NewLogger(io.Discard)
+	engine.AddStarter(db, cache, broken, hub, listen)
+	engine.AddStopper(db, stopFunc(func(*Engine) { log = append(log, "stop plain") }), cache, broken, hub, listen)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	err = engine.RunListener(listener)
+	if err == nil || !strings.Contains(err.Error(), "starter *regia.lifecycle: boom") {
+		t.Fatalf("RunListener = %v", err)
+	}
+	want := []string{"start db", "start cache", "start broken", "stop cache", "stop plain", "stop db"}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("ran %v, want %v", log, want)
+	}
+}
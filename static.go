@@ -0,0 +1,211 @@
+package regia
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// DefaultFingerprint matches the names with a content hash, such as `app.3f9a1c2b.js` or `app-3f9a1c2b.css`
+var DefaultFingerprint = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^./]+$`)
+
+// precompressed siblings in order of preference
+var staticEncodings = []struct{ encoding, ext string }{{"br", ".br"}, {gzipEncoding, ".gz"}}
+
+type StaticOptions struct {
+	// Disable the directory listing, the directory without index.html is not found
+	DisableListing bool
+
+	// Serve the `.br` or `.gz` sibling if it exists and the client accepts it
+	Precompressed bool
+
+	// Cache-Control max-age of the files, 0 means no Cache-Control
+	MaxAge time.Duration
+
+	// Files matched are cached for one year with `immutable`,
+	// such as DefaultFingerprint, nil means disabled
+	Fingerprint *regexp.Regexp
+
+	// Single page application mode, such as `index.html`.
+	// The missing paths without extension are served with it for the GET requests accepting text/html,
+	// except the paths under Exclude and the prefixes of branches included by Engine
+	Fallback string
+
+	// Prefixes never fall back, such as `/api`
+	Exclude []string
+}
+
+// Serve static files from any http.FileSystem, the missing files are handled by Engine.NotFoundHandle.
+// Files served at `/` do not conflict with other routes, they are only visited if no route matched.
+//
+//	engine.StaticFS("/assets", http.Dir("dist"), regia.StaticOptions{
+//		DisableListing: true,
+//		Precompressed:  true,
+//		Fingerprint:    regia.DefaultFingerprint,
+//	})
+func (e *Engine) StaticFS(url string, fs http.FileSystem, options StaticOptions, group ...HandleFunc) {
+	if strings.Contains(url, "*") {
+		panic("`url` should not have wildcards")
+	}
+	handler := &staticHandler{fs: fs, options: options, server: http.FileServer(fs), engine: e}
+	group = append(group, handler.serve)
+	if url == "/" && e.prefix == "" {
+		e.rootStatic = append(append(HandleFuncGroup{}, e.middleware...), group...)
+		return
+	}
+	if !strings.HasSuffix(url, FilePathParam) {
+		if !strings.HasSuffix(url, "/") {
+			url += "/"
+		}
+		url += wildFilepath
+	}
+	e.Handle(http.MethodGet, url, group...)
+	e.Handle(http.MethodHead, url, group...)
+}
+
+type staticHandler struct {
+	fs      http.FileSystem
+	options StaticOptions
+	server  http.Handler
+	engine  *Engine
+}
+
+func (s *staticHandler) serve(ctx *Context) {
+	name := path.Clean("/" + ctx.Request.Params.Get(FilePathParam).String())
+	file, err := s.fs.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) && s.fallback(ctx, name) {
+			return
+		}
+		s.error(ctx, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		s.error(ctx, err)
+		return
+	}
+	if info.IsDir() {
+		urlPath := ctx.Raw.Request.URL.Path
+		if !strings.HasSuffix(urlPath, "/") {
+			target := path.Base(urlPath) + "/"
+			if query := ctx.Raw.Request.URL.RawQuery; query != "" {
+				target += "?" + query
+			}
+			ctx.Response.Redirect(http.StatusMovedPermanently, target)
+			return
+		}
+		index, err := s.fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			if s.options.DisableListing {
+				ctx.Engine.NotFoundHandle(ctx)
+				return
+			}
+			// let http.FileServer list the directory
+			request := *ctx.Raw.Request
+			u := *request.URL
+			u.Path = name + "/"
+			request.URL = &u
+			s.server.ServeHTTP(ctx.Raw.Writer, &request)
+			return
+		}
+		defer index.Close()
+		if info, err = index.Stat(); err != nil || info.IsDir() {
+			ctx.Engine.NotFoundHandle(ctx)
+			return
+		}
+		name, file = path.Join(name, "index.html"), index
+	}
+	s.serveFile(ctx, name, file, info)
+}
+
+func (s *staticHandler) serveFile(ctx *Context, name string, file http.File, info os.FileInfo) {
+	header := ctx.Response.Header()
+	if s.options.Fingerprint != nil && s.options.Fingerprint.MatchString(path.Base(name)) {
+		header.Set("Cache-Control", immutableCacheControl)
+	} else if s.options.MaxAge > 0 {
+		header.Set("Cache-Control", "public, max-age="+strconv.FormatInt(int64(s.options.MaxAge/time.Second), 10))
+	}
+	if s.options.Precompressed {
+		addVary(header, "Accept-Encoding")
+		accept := ctx.Request.Header().AcceptEncoding()
+		for _, e := range staticEncodings {
+			if accept.Quality(e.encoding) <= 0 {
+				continue
+			}
+			compressed, err := s.fs.Open(name + e.ext)
+			if err != nil {
+				continue
+			}
+			defer compressed.Close()
+			compressedInfo, err := compressed.Stat()
+			if err != nil || compressedInfo.IsDir() {
+				continue
+			}
+			header.Set(contentType, contentTypeByName(name))
+			header.Set("Content-Encoding", e.encoding)
+			http.ServeContent(ctx.Raw.Writer, ctx.Raw.Request, name, info.ModTime(), compressed)
+			return
+		}
+	}
+	http.ServeContent(ctx.Raw.Writer, ctx.Raw.Request, name, info.ModTime(), file)
+}
+
+// serve the fallback file of single page application, returns false if the request should not fall back
+func (s *staticHandler) fallback(ctx *Context, name string) bool {
+	request := ctx.Raw.Request
+	if s.options.Fallback == "" || request.Method != http.MethodGet && request.Method != http.MethodHead || path.Ext(name) != "" {
+		return false
+	}
+	if !acceptsHtml(ctx.Request.Header().Accept()) {
+		return false
+	}
+	urlPath := request.URL.Path
+	for _, prefix := range append(s.engine.Branch.Prefixes(), s.options.Exclude...) {
+		if prefix = strings.TrimSuffix(prefix, "/"); prefix == "" {
+			continue
+		}
+		if urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return false
+		}
+	}
+	fallback := path.Clean("/" + s.options.Fallback)
+	file, err := s.fs.Open(fallback)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	// the entry should be revalidated to pick up the new assets
+	ctx.Response.SetHeader("Cache-Control", "no-cache")
+	http.ServeContent(ctx.Raw.Writer, request, fallback, info.ModTime(), file)
+	return true
+}
+
+// text/html is listed explicitly, `*/*` is sent by the scripts
+func acceptsHtml(accept AcceptList) bool {
+	for _, item := range accept {
+		if item.Quality > 0 && (item.Value == "text/html" || item.Value == "application/xhtml+xml") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *staticHandler) error(ctx *Context, err error) {
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		ctx.Engine.NotFoundHandle(ctx)
+		return
+	}
+	http.Error(ctx.Raw.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
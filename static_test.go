@@ -0,0 +1,200 @@
+package regia
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func staticFiles() fstest.MapFS {
+	file := func(data string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(data), ModTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	return fstest.MapFS{
+		"app.js":              file("console.log('app')"),
+		"app.js.br":           file("brotli"),
+		"app.js.gz":           file("gzipped"),
+		"style.css":           file("body{}"),
+		"style.css.gz":        file("gzipped css"),
+		"app.3f9a1c2b.js":     file("fingerprinted"),
+		"docs/index.html":     file("<h1>docs</h1>"),
+		"images/a.png":        file("\x89PNG\r\n\x1a\n"),
+		"index.html":          file("<div id=app></div>"),
+		"images/sub/b.png.gz": file("not a dir"),
+	}
+}
+
+type staticResponse struct {
+	status int
+	body   string
+	header http.Header
+}
+
+func getStatic(t *testing.T, engine *Engine, method, path string, headers ...string) staticResponse {
+	t.Helper()
+	request := httptest.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return staticResponse{recorder.Code, recorder.Body.String(), recorder.Header()}
+}
+
+func TestStaticFS(t *testing.T) {
+	engine := New()
+	engine.StaticFS("/assets", http.FS(staticFiles()), StaticOptions{MaxAge: time.Hour, Fingerprint: DefaultFingerprint})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := getStatic(t, engine, "GET", "/assets/app.js")
+	if resp.status != http.StatusOK || resp.body != "console.log('app')" || !strings.HasPrefix(resp.header.Get(contentType), "text/javascript") ||
+		resp.header.Get("Cache-Control") != "public, max-age=3600" || resp.header.Get("Content-Encoding") != "" {
+		t.Fatalf("GET app.js = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "HEAD", "/assets/app.js"); resp.status != http.StatusOK || resp.body != "" || resp.header.Get("Content-Length") != "18" {
+		t.Fatalf("HEAD app.js = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/app.3f9a1c2b.js"); resp.header.Get("Cache-Control") != immutableCacheControl {
+		t.Fatalf("fingerprinted Cache-Control = %q", resp.header.Get("Cache-Control"))
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/app.js", "Range", "bytes=0-6"); resp.status != http.StatusPartialContent || resp.body != "console" {
+		t.Fatalf("Range = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/app.js", "If-Modified-Since", "Mon, 01 Jan 2024 00:00:00 GMT"); resp.status != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since = %d", resp.status)
+	}
+
+	// directories
+	if resp := getStatic(t, engine, "GET", "/assets/docs?v=1"); resp.status != http.StatusMovedPermanently || resp.header.Get("Location") != "/assets/docs/?v=1" {
+		t.Fatalf("directory without slash = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/docs/"); resp.status != http.StatusOK || resp.body != "<h1>docs</h1>" {
+		t.Fatalf("directory index = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/images/"); resp.status != http.StatusOK || !strings.Contains(resp.body, `<a href="a.png">a.png</a>`) {
+		t.Fatalf("directory listing = %+v", resp)
+	}
+
+	for _, path := range []string{"/assets/missing.js", "/assets/../regia.go", "/assets/%2e%2e/regia.go", "/missing"} {
+		if resp := getStatic(t, engine, "GET", path); resp.status != http.StatusNotFound {
+			t.Errorf("GET %s = %d %q", path, resp.status, resp.body)
+		}
+	}
+}
+
+func TestStaticFSDisableListing(t *testing.T) {
+	engine := New()
+	engine.StaticFS("/assets", http.FS(staticFiles()), StaticOptions{DisableListing: true})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/images/"); resp.status != http.StatusNotFound {
+		t.Fatalf("listing = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/assets/docs/"); resp.status != http.StatusOK {
+		t.Fatalf("index with listing disabled = %+v", resp)
+	}
+}
+
+func TestStaticFSPrecompressed(t *testing.T) {
+	engine := New()
+	engine.StaticFS("/assets", http.FS(staticFiles()), StaticOptions{Precompressed: true})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, accept, encoding, body string
+	}{
+		{"/assets/app.js", "gzip, br", "br", "brotli"},
+		{"/assets/app.js", "gzip, br;q=0", "gzip", "gzipped"},
+		{"/assets/app.js", "", "", "console.log('app')"},
+		{"/assets/style.css", "br, gzip", "gzip", "gzipped css"},
+		// the sibling is a directory
+		{"/assets/images/a.png", "gzip", "", "\x89PNG\r\n\x1a\n"},
+	}
+	for _, test := range tests {
+		resp := getStatic(t, engine, "GET", test.path, "Accept-Encoding", test.accept)
+		if resp.body != test.body || resp.header.Get("Content-Encoding") != test.encoding || resp.header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s Accept-Encoding %q: %+v", test.path, test.accept, resp)
+		}
+		// the type of the original file, not of the sibling
+		if test.encoding != "" && !strings.HasPrefix(resp.header.Get(contentType), contentTypeByName(test.path)) {
+			t.Errorf("%s: Content-Type %q", test.path, resp.header.Get(contentType))
+		}
+	}
+}
+
+// files at `/` are visited only if no route matched
+func TestStaticFSRoot(t *testing.T) {
+	engine := New()
+	engine.GET("/app.js", func(ctx *Context) { _, _ = ctx.Response.String("route") })
+	engine.StaticFS("/", http.FS(staticFiles()), StaticOptions{})
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	if resp := getStatic(t, engine, "GET", "/app.js"); resp.body != "route" {
+		t.Fatalf("route = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "GET", "/style.css"); resp.body != "body{}" {
+		t.Fatalf("root file = %+v", resp)
+	}
+	if resp := getStatic(t, engine, "POST", "/style.css"); resp.status != http.StatusNotFound {
+		t.Fatalf("POST root file = %+v", resp)
+	}
+}
+
+func TestStaticFSFallback(t *testing.T) {
+	users := func(context *Context) { context.Response.String("users") }
+	newEngine := func(include func(engine *Engine)) *Engine {
+		engine := New()
+		include(engine)
+		engine.StaticFS("/", http.FS(staticFiles()), StaticOptions{Fallback: "index.html", Exclude: []string{"/internal"}})
+		if err := engine.init(); err != nil {
+			t.Fatal(err)
+		}
+		return engine
+	}
+	for name, include := range map[string]func(engine *Engine){
+		"include prefix": func(engine *Engine) {
+			api := NewBranch()
+			api.GET("/users", users)
+			engine.Include("/api", api)
+		},
+		"branch prefix": func(engine *Engine) {
+			api := NewBranch()
+			api.SetPrefix("/api")
+			api.GET("/users", users)
+			engine.Include("", api)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			engine := newEngine(include)
+			if resp := getStatic(t, engine, "GET", "/api/users"); resp.status != http.StatusOK || resp.body != "users" {
+				t.Fatalf("route = %+v", resp)
+			}
+			for _, path := range []string{"/api", "/api/missing", "/internal/page"} {
+				if resp := getStatic(t, engine, "GET", path, "Accept", "text/html"); resp.status != http.StatusNotFound {
+					t.Fatalf("GET %s fell back: %+v", path, resp)
+				}
+			}
+			resp := getStatic(t, engine, "GET", "/settings/profile", "Accept", "text/html,*/*;q=0.8")
+			if resp.status != http.StatusOK || resp.body != "<div id=app></div>" || resp.header.Get("Cache-Control") != "no-cache" {
+				t.Fatalf("fallback = %+v", resp)
+			}
+			if resp := getStatic(t, engine, "GET", "/apiary", "Accept", "text/html"); resp.status != http.StatusOK {
+				t.Fatalf("sibling of the branch prefix = %+v", resp)
+			}
+			if resp := getStatic(t, engine, "GET", "/settings/profile", "Accept", "application/json"); resp.status != http.StatusNotFound {
+				t.Fatalf("json request fell back: %+v", resp)
+			}
+			if resp := getStatic(t, engine, "GET", "/missing.js", "Accept", "text/html"); resp.status != http.StatusNotFound {
+				t.Fatalf("missing asset fell back: %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package regia
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var invalidFileNameError = errors.New("invalid file name")
+
+// FileStorage is used to store the uploaded files
+type FileStorage interface {
+	// Save stores the content under the name and returns the name actually used,
+	// it may differ from the given one to avoid collision
+	Save(name string, reader io.Reader) (string, error)
+
+	// Open returns the content of the file, the error satisfies os.IsNotExist if missing
+	Open(name string) (io.ReadCloser, error)
+
+	// Stat returns the information of the file, the error satisfies os.IsNotExist if missing
+	Stat(name string) (*FileInfo, error)
+
+	Delete(name string) error
+
+	// URL returns the address to visit the file
+	URL(name string) string
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// UniqueFileName replaces the base name with a random one and keeps the directory and extension,
+// `avatar/me.png` => `avatar/2f1b7c...9e.png`
+func UniqueFileName(name string) string {
+	dir, base := path.Split(filepath.ToSlash(name))
+	return dir + randomHex(16) + path.Ext(base)
+}
+
+// CleanFileName cleans the name as a slash separated relative path,
+// it can not escape the root of storage
+func CleanFileName(name string) (string, error) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return "", invalidFileNameError
+	}
+	name = strings.TrimPrefix(path.Clean("/"+strings.Replace(name, "\\", "/", -1)), "/")
+	if name == "" {
+		return "", invalidFileNameError
+	}
+	return name, nil
+}
+
+// appends a random suffix to the base name, `a/b.txt` => `a/b_1f2e3d4c.txt`
+func collisionFreeName(name string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + randomHex(4) + ext
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func joinURL(base, name string) string {
+	return strings.TrimSuffix(base, "/") + "/" + name
+}
+
+func contentTypeByName(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// LocalFileStorage stores files under Root of the local disk.
+// The content is written to a temp file then renamed, so a file never appears half written.
+type LocalFileStorage struct {
+	Root string
+
+	// prefix of URL, such as `/media`
+	BaseURL string
+
+	// Overwrite the existing file, default false means save it with another name
+	Overwrite bool
+}
+
+func NewLocalFileStorage(root, baseURL string) *LocalFileStorage {
+	return &LocalFileStorage{Root: root, BaseURL: baseURL}
+}
+
+func (l *LocalFileStorage) path(name string) (string, string, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return "", "", err
+	}
+	return name, filepath.Join(l.Root, filepath.FromSlash(name)), nil
+}
+
+func (l *LocalFileStorage) Save(name string, reader io.Reader) (string, error) {
+	name, target, err := l.path(name)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	reserved := false
+	if err == nil && !l.Overwrite {
+		name, target, err = l.reserve(name, target)
+		reserved = err == nil
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		if reserved {
+			// do not leave the empty placeholder
+			_ = os.Remove(target)
+		}
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+// create an empty placeholder exclusively to avoid two uploads taking the same name,
+// it will be replaced by the temp file atomically
+func (l *LocalFileStorage) reserve(name, target string) (string, string, error) {
+	for {
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			return name, target, file.Close()
+		}
+		if !os.IsExist(err) {
+			return "", "", err
+		}
+		if name, target, err = l.path(collisionFreeName(name)); err != nil {
+			return "", "", err
+		}
+	}
+}
+
+func (l *LocalFileStorage) Open(name string) (io.ReadCloser, error) {
+	_, target, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(target)
+}
+
+func (l *LocalFileStorage) Stat(name string) (*FileInfo, error) {
+	name, target, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "stat", Path: target, Err: os.ErrNotExist}
+	}
+	return &FileInfo{Name: name, Size: info.Size(), ModTime: info.ModTime(), ContentType: contentTypeByName(name)}, nil
+}
+
+func (l *LocalFileStorage) Delete(name string) error {
+	_, target, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(target)
+}
+
+func (l *LocalFileStorage) URL(name string) string {
+	name, _ = CleanFileName(name)
+	return joinURL(l.BaseURL, name)
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryFileStorage keeps files in memory, it is helpful for testing
+type MemoryFileStorage struct {
+	BaseURL   string
+	Overwrite bool
+	files     map[string]memoryFile
+	mu        sync.RWMutex
+}
+
+func NewMemoryFileStorage() *MemoryFileStorage {
+	return &MemoryFileStorage{files: make(map[string]memoryFile)}
+}
+
+func (m *MemoryFileStorage) Save(name string, reader io.Reader) (string, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = make(map[string]memoryFile)
+	}
+	for !m.Overwrite {
+		if _, exist := m.files[name]; !exist {
+			break
+		}
+		name = collisionFreeName(name)
+	}
+	m.files[name] = memoryFile{data: data, modTime: time.Now()}
+	return name, nil
+}
+
+func (m *MemoryFileStorage) get(op, name string) (string, memoryFile, error) {
+	name, err := CleanFileName(name)
+	if err != nil {
+		return "", memoryFile{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	file, exist := m.files[name]
+	if !exist {
+		return "", memoryFile{}, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return name, file, nil
+}
+
+func (m *MemoryFileStorage) Open(name string) (io.ReadCloser, error) {
+	_, file, err := m.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(file.data)), nil
+}
+
+func (m *MemoryFileStorage) Stat(name string) (*FileInfo, error) {
+	name, file, err := m.get("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{Name: name, Size: int64(len(file.data)), ModTime: file.modTime, ContentType: contentTypeByName(name)}, nil
+}
+
+func (m *MemoryFileStorage) Delete(name string) error {
+	name, _, err := m.get("remove", name)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemoryFileStorage) URL(name string) string {
+	name, _ = CleanFileName(name)
+	return joinURL(m.BaseURL, name)
+}
@@ -0,0 +1,153 @@
+package regia
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readStored(t *testing.T, storage FileStorage, name string) string {
+	t.Helper()
+	reader, err := storage.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCleanFileName(t *testing.T) {
+	cases := map[string]string{
+		"a/b.txt":           "a/b.txt",
+		"../../etc/passwd":  "etc/passwd",
+		"/abs/../x.txt":     "x.txt",
+		`..\..\windows.ini`: "windows.ini",
+		"a/./b/../c.txt":    "a/c.txt",
+	}
+	for name, expected := range cases {
+		if cleaned, err := CleanFileName(name); err != nil || cleaned != expected {
+			t.Errorf("CleanFileName(%q) = %q, %v, want %q", name, cleaned, err, expected)
+		}
+	}
+	for _, name := range []string{"", "..", "/", "a\x00b"} {
+		if _, err := CleanFileName(name); err != invalidFileNameError {
+			t.Errorf("CleanFileName(%q) = %v, want invalidFileNameError", name, err)
+		}
+	}
+}
+
+func TestLocalFileStorageTraversal(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	storage := NewLocalFileStorage(root, "/media")
+	name, err := storage.Save("../../escape.txt", strings.NewReader("data"))
+	if err != nil || name != "escape.txt" {
+		t.Fatalf("Save = %q, %v", name, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatalf("the file should be inside the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("the file escaped the root: %v", err)
+	}
+	if _, err := storage.Save("..", strings.NewReader("data")); err != invalidFileNameError {
+		t.Fatalf("Save(..) = %v", err)
+	}
+	if _, err := storage.Open("../root/../../escape.txt"); err != nil {
+		t.Fatalf("Open should be cleaned into the root: %v", err)
+	}
+	if url := storage.URL("../a b.png"); url != "/media/a b.png" {
+		t.Fatalf("URL = %q", url)
+	}
+}
+
+func TestLocalFileStorageCollision(t *testing.T) {
+	root := t.TempDir()
+	storage := NewLocalFileStorage(root, "")
+	first, err := storage.Save("dir/a.txt", strings.NewReader("first"))
+	if err != nil || first != "dir/a.txt" {
+		t.Fatalf("Save = %q, %v", first, err)
+	}
+	second, err := storage.Save("dir/a.txt", strings.NewReader("second"))
+	if err != nil || second == first || !strings.HasPrefix(second, "dir/a_") || !strings.HasSuffix(second, ".txt") {
+		t.Fatalf("Save of the existing name = %q, %v", second, err)
+	}
+	if readStored(t, storage, first) != "first" || readStored(t, storage, second) != "second" {
+		t.Fatal("the existing file was overwritten")
+	}
+
+	storage.Overwrite = true
+	if same, err := storage.Save("dir/a.txt", strings.NewReader("third")); err != nil || same != first {
+		t.Fatalf("Save with Overwrite = %q, %v", same, err)
+	}
+	if readStored(t, storage, first) != "third" {
+		t.Fatal("Overwrite did not replace the file")
+	}
+
+	info, err := storage.Stat(first)
+	if err != nil || info.Size != 5 || info.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	if _, err := storage.Stat("dir"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of a directory = %v", err)
+	}
+	if err := storage.Delete(first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Open(first); !os.IsNotExist(err) {
+		t.Fatalf("Open of the deleted file = %v", err)
+	}
+	// no temp file is left
+	entries, _ := os.ReadDir(filepath.Join(root, "dir"))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			t.Fatalf("temp file %s is left", entry.Name())
+		}
+	}
+}
+
+func TestMemoryFileStorage(t *testing.T) {
+	storage := NewMemoryFileStorage()
+	storage.BaseURL = "/files"
+	name, err := storage.Save("../a.txt", strings.NewReader("first"))
+	if err != nil || name != "a.txt" {
+		t.Fatalf("Save = %q, %v", name, err)
+	}
+	second, err := storage.Save("a.txt", strings.NewReader("second"))
+	if err != nil || second == name || !strings.HasPrefix(second, "a_") {
+		t.Fatalf("Save of the existing name = %q, %v", second, err)
+	}
+	if readStored(t, storage, name) != "first" || readStored(t, storage, second) != "second" {
+		t.Fatal("the existing file was overwritten")
+	}
+	storage.Overwrite = true
+	if same, err := storage.Save("a.txt", strings.NewReader("third")); err != nil || same != name {
+		t.Fatalf("Save with Overwrite = %q, %v", same, err)
+	}
+	info, err := storage.Stat(name)
+	if err != nil || info.Size != 5 || info.Name != "a.txt" {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	if err := storage.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("Stat of the deleted file = %v", err)
+	}
+	if err := storage.Delete(name); !os.IsNotExist(err) {
+		t.Fatalf("Delete of the deleted file = %v", err)
+	}
+	if url := storage.URL("b.txt"); url != "/files/b.txt" {
+		t.Fatalf("URL = %q", url)
+	}
+	// the zero value is usable
+	var zero MemoryFileStorage
+	if _, err := zero.Save("z.txt", strings.NewReader("z")); err != nil {
+		t.Fatal(err)
+	}
+}
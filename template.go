@@ -0,0 +1,260 @@
+package regia
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultTemplateExtension  = ".html"
+	defaultTemplateLayoutDir  = "layouts"
+	defaultTemplatePartialDir = "partials"
+)
+
+// TemplateLoader parses a directory of templates and implements HtmlRender.
+//
+// Templates are named by the path relative to Dir without extension, such as `users/index`.
+// Every page is parsed with the files under PartialDir and its own layout under LayoutDir,
+// so a page can define the blocks of its layout and include the partials,
+// the layouts may define the blocks of the same name:
+//
+//	layouts/base.html:  <html>{{template "partials/nav" .}}{{block "content" .}}{{end}}</html>
+//	partials/nav.html:  <nav><a href="{{url "/"}}">Home</a></nav>
+//	users/index.html:   {{define "content"}}<script src="{{asset "app.js"}}"></script>{{end}}
+//
+//	loader := regia.NewTemplateLoader("templates")
+//	loader.DefaultLayout = "layouts/base"
+//	engine.HtmlRender = loader
+//	ctx.Response.Html("users/index", data)
+type TemplateLoader struct {
+	Dir string
+
+	// Extension of the template files, default `.html`
+	Extension string
+
+	// Directories of layouts and partials relative to Dir, default `layouts` and `partials`
+	LayoutDir  string
+	PartialDir string
+
+	// Layout executed for the pages, such as `layouts/base`, empty means the page is executed directly
+	DefaultLayout string
+
+	// Layout of the specified pages, overrides DefaultLayout, empty value means no layout.
+	// The layouts are resolved when the templates are parsed.
+	Layouts map[string]string
+
+	// Functions available in all templates besides `url` and `asset`
+	Funcs template.FuncMap
+
+	// Prefix of the `url` function, such as `/app`
+	BaseURL string
+
+	// Prefix of the `asset` function, such as `/static`
+	AssetURL string
+
+	// Version appended to the assets as `?v=`, used to bust the caches after deployment
+	AssetVersion string
+
+	// Reload the templates from disk on every render, for development
+	Reload bool
+
+	pages map[string]*template.Template
+	mu    sync.RWMutex
+}
+
+func NewTemplateLoader(dir string) *TemplateLoader {
+	return &TemplateLoader{Dir: dir}
+}
+
+// Render implement HtmlRender
+func (t *TemplateLoader) Render(writer http.ResponseWriter, name string, data interface{}) error {
+	pages, err := t.load()
+	if err != nil {
+		return err
+	}
+	page, exist := pages[name]
+	if !exist {
+		return fmt.Errorf("template %q not found", name)
+	}
+	layout := t.layoutOf(name)
+	if layout == "" {
+		layout = name
+	}
+	// execute into buffer, so a failed template writes nothing
+	buffer := &bytes.Buffer{}
+	if err := page.ExecuteTemplate(buffer, layout, data); err != nil {
+		return err
+	}
+	writeContentType(writer, textHtmlContentType)
+	_, err = writer.Write(buffer.Bytes())
+	return err
+}
+
+// Load parses all templates, it is called lazily by Render,
+// call it at startup to report the errors early
+func (t *TemplateLoader) Load() error {
+	pages, err := t.parse()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.pages = pages
+	t.mu.Unlock()
+	return nil
+}
+
+// Names returns the names of all pages
+func (t *TemplateLoader) Names() []string {
+	pages, err := t.load()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (t *TemplateLoader) load() (map[string]*template.Template, error) {
+	if t.Reload {
+		return t.parse()
+	}
+	t.mu.RLock()
+	pages := t.pages
+	t.mu.RUnlock()
+	if pages != nil {
+		return pages, nil
+	}
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.pages, nil
+}
+
+func (t *TemplateLoader) parse() (map[string]*template.Template, error) {
+	extension := t.Extension
+	if extension == "" {
+		extension = defaultTemplateExtension
+	}
+	layoutDir, partialDir := t.LayoutDir, t.PartialDir
+	if layoutDir == "" {
+		layoutDir = defaultTemplateLayoutDir
+	}
+	if partialDir == "" {
+		partialDir = defaultTemplatePartialDir
+	}
+	layouts := make(map[string]string)
+	partials := make(map[string]string)
+	pages := make(map[string]string)
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != extension {
+			return err
+		}
+		rel, err := filepath.Rel(t.Dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), extension)
+		switch {
+		case strings.HasPrefix(name, layoutDir+"/"):
+			layouts[name] = string(content)
+		case strings.HasPrefix(name, partialDir+"/"):
+			partials[name] = string(content)
+		default:
+			pages[name] = string(content)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	base := template.New("").Funcs(t.funcMap())
+	for name, content := range partials {
+		if _, err := base.New(name).Parse(content); err != nil {
+			return nil, err
+		}
+	}
+	// every layout gets its own set, so the blocks of the layouts don't override each other
+	sets := map[string]*template.Template{"": base}
+	for name, content := range layouts {
+		set, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := set.New(name).Parse(content); err != nil {
+			return nil, err
+		}
+		sets[name] = set
+	}
+	result := make(map[string]*template.Template, len(pages))
+	for name, content := range pages {
+		layout := t.layoutOf(name)
+		set, exist := sets[layout]
+		if !exist {
+			return nil, fmt.Errorf("layout %q of template %q not found", layout, name)
+		}
+		page, err := set.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := page.New(name).Parse(content); err != nil {
+			return nil, err
+		}
+		result[name] = page
+	}
+	return result, nil
+}
+
+// the layout of the page, empty means no layout
+func (t *TemplateLoader) layoutOf(name string) string {
+	if layout, exist := t.Layouts[name]; exist {
+		return layout
+	}
+	return t.DefaultLayout
+}
+
+func (t *TemplateLoader) funcMap() template.FuncMap {
+	funcs := template.FuncMap{
+		// url "/users" "page" 2 => /users?page=2
+		"url": func(path string, pairs ...interface{}) string {
+			u := path
+			if t.BaseURL != "" {
+				u = strings.TrimSuffix(t.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+			}
+			query := url.Values{}
+			for i := 0; i+1 < len(pairs); i += 2 {
+				query.Add(fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1]))
+			}
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			return u
+		},
+		"asset": func(name string) string {
+			u := joinURL(t.AssetURL, strings.TrimPrefix(name, "/"))
+			if t.AssetVersion != "" {
+				u += "?v=" + url.QueryEscape(t.AssetVersion)
+			}
+			return u
+		},
+	}
+	for name, fn := range t.Funcs {
+		funcs[name] = fn
+	}
+	return funcs
+}
@@ -0,0 +1,113 @@
+package regia
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTemplateLoader(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/base.html":  `<main>{{template "partials/nav" .}}{{block "title" .}}Site{{end}}|{{block "content" .}}{{end}}</main>`,
+		"layouts/admin.html": `<admin>{{block "title" .}}Admin{{end}}|{{block "content" .}}{{end}}</admin>`,
+		"partials/nav.html":  `<a href="{{url "/users" "page" 2}}">{{.}}</a>`,
+		"users/index.html":   `{{define "content"}}<script src="{{asset "app.js"}}"></script>{{end}}`,
+		"admin/index.html":   `{{define "content"}}{{shout .}}{{end}}`,
+		"plain.html":         `plain {{.}}`,
+		"README.md":          `not a template`,
+	})
+	loader := NewTemplateLoader(dir)
+	loader.DefaultLayout = "layouts/base"
+	loader.Layouts = map[string]string{"admin/index": "layouts/admin", "plain": ""}
+	loader.BaseURL = "/app"
+	loader.AssetURL = "/static"
+	loader.AssetVersion = "1.0"
+	loader.Funcs = map[string]interface{}{"shout": strings.ToUpper}
+	if err := loader.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if names := loader.Names(); len(names) != 3 {
+		t.Fatalf("Names = %v", names)
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"users/index", `<main><a href="/app/users?page=2">ivy</a>Site|<script src="/static/app.js?v=1.0"></script></main>`},
+		// the blocks of the other layout don't leak in
+		{"admin/index", `<admin>Admin|IVY</admin>`},
+		{"plain", `plain ivy`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		if err := loader.Render(recorder, test.name, "ivy"); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if recorder.Body.String() != test.want || recorder.Header().Get(contentType) != textHtmlContentType {
+			t.Errorf("%s = %q, %q", test.name, recorder.Body, recorder.Header().Get(contentType))
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if err := loader.Render(recorder, "missing", nil); err == nil {
+		t.Fatal("missing template rendered")
+	}
+	// a failed execution writes nothing
+	if err := loader.Render(recorder, "admin/index", 1); err == nil || recorder.Body.Len() != 0 {
+		t.Fatalf("failed render = %v, %q", err, recorder.Body)
+	}
+}
+
+func TestTemplateLoaderErrors(t *testing.T) {
+	loader := NewTemplateLoader(writeTemplates(t, map[string]string{"index.html": `ok`}))
+	loader.DefaultLayout = "layouts/missing"
+	if err := loader.Load(); err == nil || !strings.Contains(err.Error(), "layouts/missing") {
+		t.Fatalf("missing layout = %v", err)
+	}
+	loader = NewTemplateLoader(writeTemplates(t, map[string]string{"index.html": `{{if}}`}))
+	if err := loader.Load(); err == nil {
+		t.Fatal("invalid template parsed")
+	}
+}
+
+func TestTemplateLoaderReload(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{"index.html": `v1`})
+	loader := NewTemplateLoader(dir)
+	render := func() string {
+		recorder := httptest.NewRecorder()
+		if err := loader.Render(recorder, "index", nil); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Body.String()
+	}
+	if got := render(); got != "v1" {
+		t.Fatalf("render = %q", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(`v2`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "v1" {
+		t.Fatalf("cached render = %q", got)
+	}
+	loader.Reload = true
+	if got := render(); got != "v2" {
+		t.Fatalf("reloaded render = %q", got)
+	}
+}
@@ -0,0 +1,454 @@
+package regia
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tusVersion       = "1.0.0"
+	tusExtensions    = "creation,termination,expiration"
+	tusContentType   = "application/offset+octet-stream"
+	tusIDParam       = "id"
+	tusDefaultPrefix = ".tus/"
+
+	defaultTusExpiration = 24 * time.Hour
+	tusSweepInterval     = time.Minute
+)
+
+// TusUpload is the state of a resumable upload
+type TusUpload struct {
+	ID       string
+	Size     int64
+	Offset   int64
+	Metadata map[string]string
+
+	// Name is the name in FileStorage after the upload is completed
+	Name string
+
+	// The upload and its chunks are deleted after Expires,
+	// it is extended by every PATCH
+	Expires time.Time
+
+	rawMetadata string
+	chunks      []string
+	busy        bool
+	completed   bool
+}
+
+// TusHandler implements the core protocol of tus 1.0 with creation, termination and expiration extensions.
+// The partial data is stored as chunks through FileStorage and assembled after completed.
+// The upload states are kept in memory, so the uploads can not be resumed after the process restarts,
+// and their chunks are left in Storage under ChunkPrefix.
+//
+//	tus := regia.NewTusHandler()
+//	tus.OnComplete = func(ctx *regia.Context, upload *regia.TusUpload) {}
+//	tus.Register(engine.Branch, "/files")
+type TusHandler struct {
+	// default Engine.FileStorage
+	Storage FileStorage
+
+	// Max size of an upload, 0 means no limit
+	MaxSize int64
+
+	// Prefix of the chunk names in Storage, default `.tus/`
+	ChunkPrefix string
+
+	// NameFunc returns the name to store the completed file,
+	// default UniqueFileName with the `filename` of the metadata
+	NameFunc func(upload *TusUpload) string
+
+	// OnComplete will be called after the file is assembled
+	OnComplete func(ctx *Context, upload *TusUpload)
+
+	// The upload expires if it is not patched in the duration, the expired uploads
+	// are deleted with their chunks. The completed uploads are kept until they expire,
+	// so a client lost the response of the last PATCH can confirm it by HEAD. Default 24 hours
+	Expiration time.Duration
+
+	uploads   map[string]*TusUpload
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewTusHandler() *TusHandler {
+	return &TusHandler{uploads: make(map[string]*TusUpload)}
+}
+
+// Register all handles to the branch, uploads are created at path and visited at path/:id
+func (t *TusHandler) Register(branch *Branch, path string, group ...HandleFunc) {
+	path = strings.TrimSuffix(path, "/")
+	uploadPath := path + "/:" + tusIDParam
+	branch.Handle(http.MethodOptions, path, append(group, t.Options)...)
+	branch.Handle(http.MethodPost, path, append(group, t.Create)...)
+	branch.Handle(http.MethodHead, uploadPath, append(group, t.Head)...)
+	branch.Handle(http.MethodPatch, uploadPath, append(group, t.Patch)...)
+	branch.Handle(http.MethodDelete, uploadPath, append(group, t.Terminate)...)
+}
+
+// Options responds the capabilities of the server
+func (t *TusHandler) Options(ctx *Context) {
+	header := ctx.Response.Header()
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	if t.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(t.MaxSize, 10))
+	}
+	t.writeStatus(ctx, http.StatusNoContent)
+}
+
+// Create creates an upload with `Upload-Length` and `Upload-Metadata`
+func (t *TusHandler) Create(ctx *Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+	header := ctx.Request.Header()
+	size := header.Get("Upload-Length").Int64(-1)
+	if size < 0 {
+		t.error(ctx, http.StatusBadRequest, "invalid Upload-Length")
+		return
+	}
+	if t.MaxSize > 0 && size > t.MaxSize {
+		t.error(ctx, http.StatusRequestEntityTooLarge, "upload is too large")
+		return
+	}
+	rawMetadata := header.Get("Upload-Metadata").String()
+	metadata, ok := parseTusMetadata(rawMetadata)
+	if !ok {
+		t.error(ctx, http.StatusBadRequest, "invalid Upload-Metadata")
+		return
+	}
+	t.sweep(ctx)
+	upload := &TusUpload{ID: randomHex(16), Size: size, Metadata: metadata, rawMetadata: rawMetadata, Expires: t.expires()}
+	t.mu.Lock()
+	if t.uploads == nil {
+		t.uploads = make(map[string]*TusUpload)
+	}
+	t.uploads[upload.ID] = upload
+	t.mu.Unlock()
+
+	ctx.Response.SetHeader("Location", strings.TrimSuffix(ctx.Raw.Request.URL.Path, "/")+"/"+upload.ID)
+	// an empty upload is completed once it is created
+	if size == 0 {
+		if !t.complete(ctx, upload) {
+			return
+		}
+	} else {
+		ctx.Response.SetHeader("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	}
+	t.writeStatus(ctx, http.StatusCreated)
+}
+
+// Head responds the offset of the upload
+func (t *TusHandler) Head(ctx *Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+	upload := t.get(ctx)
+	if upload == nil {
+		return
+	}
+	t.mu.Lock()
+	offset, expires := upload.Offset, upload.Expires
+	t.mu.Unlock()
+	header := ctx.Response.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if upload.rawMetadata != "" {
+		header.Set("Upload-Metadata", upload.rawMetadata)
+	}
+	t.writeStatus(ctx, http.StatusOK)
+}
+
+// Patch appends the request body to the upload at `Upload-Offset`
+func (t *TusHandler) Patch(ctx *Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+	if ctx.Request.Header().Get(contentType).String() != tusContentType {
+		t.error(ctx, http.StatusUnsupportedMediaType, "Content-Type should be "+tusContentType)
+		return
+	}
+	upload := t.get(ctx)
+	if upload == nil {
+		return
+	}
+	offset := ctx.Request.Header().Get("Upload-Offset").Int64(-1)
+	t.mu.Lock()
+	if t.uploads[upload.ID] != upload {
+		// swept after get
+		t.mu.Unlock()
+		t.error(ctx, http.StatusNotFound, "upload not found")
+		return
+	}
+	if upload.busy || offset != upload.Offset {
+		t.mu.Unlock()
+		t.error(ctx, http.StatusConflict, "Upload-Offset mismatched")
+		return
+	}
+	if upload.completed {
+		// the last PATCH is sent again, nothing to append
+		expires := upload.Expires
+		t.mu.Unlock()
+		ctx.Response.SetHeader("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+		ctx.Response.SetHeader("Upload-Offset", strconv.FormatInt(offset, 10))
+		t.writeStatus(ctx, http.StatusNoContent)
+		return
+	}
+	upload.busy = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		upload.busy = false
+		t.mu.Unlock()
+	}()
+	t.sweep(ctx)
+
+	// keep the data received before the connection broken
+	reader := &tusChunkReader{reader: io.LimitReader(ctx.Raw.Request.Body, upload.Size-offset)}
+	name, err := t.storage(ctx).Save(t.chunkName(upload.ID, offset), reader)
+	if err != nil {
+		t.error(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reader.n == 0 {
+		_ = t.storage(ctx).Delete(name)
+	}
+	t.mu.Lock()
+	if reader.n > 0 {
+		upload.chunks = append(upload.chunks, name)
+	}
+	upload.Offset += reader.n
+	upload.Expires = t.expires()
+	offset, expires := upload.Offset, upload.Expires
+	t.mu.Unlock()
+	if reader.err != nil {
+		return
+	}
+	if offset == upload.Size {
+		if !t.complete(ctx, upload) {
+			return
+		}
+	}
+	ctx.Response.SetHeader("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	ctx.Response.SetHeader("Upload-Offset", strconv.FormatInt(offset, 10))
+	t.writeStatus(ctx, http.StatusNoContent)
+}
+
+// Terminate deletes the upload and its data
+func (t *TusHandler) Terminate(ctx *Context) {
+	if !t.checkVersion(ctx) {
+		return
+	}
+	upload := t.get(ctx)
+	if upload == nil {
+		return
+	}
+	t.mu.Lock()
+	if upload.busy {
+		t.mu.Unlock()
+		t.error(ctx, http.StatusConflict, "upload is being patched")
+		return
+	}
+	delete(t.uploads, upload.ID)
+	chunks := upload.chunks
+	t.mu.Unlock()
+	t.deleteChunks(ctx, chunks)
+	t.writeStatus(ctx, http.StatusNoContent)
+}
+
+// assemble the chunks into one file, returns false if it failed and the response has been written
+func (t *TusHandler) complete(ctx *Context, upload *TusUpload) bool {
+	storage := t.storage(ctx)
+	name := UniqueFileName(upload.Metadata["filename"])
+	if t.NameFunc != nil {
+		name = t.NameFunc(upload)
+	}
+	t.mu.Lock()
+	chunks := upload.chunks
+	t.mu.Unlock()
+	readers := make([]io.Reader, len(chunks))
+	for i, chunk := range chunks {
+		readers[i] = &lazyStorageReader{storage: storage, name: chunk}
+	}
+	name, err := storage.Save(name, io.MultiReader(readers...))
+	for _, reader := range readers {
+		reader.(*lazyStorageReader).Close()
+	}
+	if err != nil {
+		t.error(ctx, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	t.deleteChunks(ctx, chunks)
+	// keep the upload until it expires, HEAD reports it with Upload-Offset equal to Upload-Length
+	t.mu.Lock()
+	upload.Name = name
+	upload.chunks = nil
+	upload.completed = true
+	t.mu.Unlock()
+	if t.OnComplete != nil {
+		t.OnComplete(ctx, upload)
+	}
+	return true
+}
+
+func (t *TusHandler) deleteChunks(ctx *Context, chunks []string) {
+	storage := t.storage(ctx)
+	for _, chunk := range chunks {
+		_ = storage.Delete(chunk)
+	}
+}
+
+func (t *TusHandler) get(ctx *Context) *TusUpload {
+	t.mu.Lock()
+	upload := t.uploads[ctx.Request.Params.Get(tusIDParam).String()]
+	expired := upload != nil && !upload.busy && time.Now().After(upload.Expires)
+	var chunks []string
+	if expired {
+		delete(t.uploads, upload.ID)
+		chunks = upload.chunks
+	}
+	t.mu.Unlock()
+	if expired {
+		t.deleteChunks(ctx, chunks)
+		t.error(ctx, http.StatusGone, "upload expired")
+		return nil
+	}
+	if upload == nil {
+		t.error(ctx, http.StatusNotFound, "upload not found")
+	}
+	return upload
+}
+
+func (t *TusHandler) expires() time.Time {
+	expiration := t.Expiration
+	if expiration <= 0 {
+		expiration = defaultTusExpiration
+	}
+	return time.Now().Add(expiration)
+}
+
+// delete the expired uploads and their chunks at most once per sweep interval
+func (t *TusHandler) sweep(ctx *Context) {
+	now := time.Now()
+	var chunks []string
+	t.mu.Lock()
+	if now.Sub(t.lastSweep) < tusSweepInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastSweep = now
+	for id, upload := range t.uploads {
+		if !upload.busy && now.After(upload.Expires) {
+			chunks = append(chunks, upload.chunks...)
+			delete(t.uploads, id)
+		}
+	}
+	t.mu.Unlock()
+	t.deleteChunks(ctx, chunks)
+}
+
+func (t *TusHandler) storage(ctx *Context) FileStorage {
+	if t.Storage != nil {
+		return t.Storage
+	}
+	return ctx.Engine.FileStorage
+}
+
+func (t *TusHandler) chunkName(id string, offset int64) string {
+	prefix := t.ChunkPrefix
+	if prefix == "" {
+		prefix = tusDefaultPrefix
+	}
+	return prefix + id + "/" + strconv.FormatInt(offset, 10)
+}
+
+func (t *TusHandler) checkVersion(ctx *Context) bool {
+	if ctx.Request.Header().Get("Tus-Resumable").String() != tusVersion {
+		ctx.Response.SetHeader("Tus-Version", tusVersion)
+		t.error(ctx, http.StatusPreconditionFailed, "unsupported tus version")
+		return false
+	}
+	return true
+}
+
+func (t *TusHandler) error(ctx *Context, code int, message string) {
+	ctx.Response.SetHeader("Tus-Resumable", tusVersion)
+	http.Error(ctx.Response, message, code)
+}
+
+func (t *TusHandler) writeStatus(ctx *Context, code int) {
+	ctx.Response.SetHeader("Tus-Resumable", tusVersion)
+	ctx.Response.SetStatus(code)
+}
+
+// parse `key base64,key2 base64`
+func parseTusMetadata(raw string) (map[string]string, bool) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		var value []byte
+		if len(kv) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(kv[1]); err != nil {
+				return nil, false
+			}
+		}
+		metadata[kv[0]] = string(value)
+	}
+	return metadata, true
+}
+
+// tusChunkReader ends the chunk at the first read error,
+// so the data received before the connection broken can be saved
+type tusChunkReader struct {
+	reader io.Reader
+	n      int64
+	err    error
+}
+
+func (r *tusChunkReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// lazyStorageReader opens the file on the first read
+type lazyStorageReader struct {
+	storage FileStorage
+	name    string
+	reader  io.ReadCloser
+}
+
+func (l *lazyStorageReader) Read(b []byte) (int, error) {
+	if l.reader == nil {
+		reader, err := l.storage.Open(l.name)
+		if err != nil {
+			return 0, err
+		}
+		l.reader = reader
+	}
+	return l.reader.Read(b)
+}
+
+func (l *lazyStorageReader) Close() error {
+	if l.reader == nil {
+		return nil
+	}
+	return l.reader.Close()
+}
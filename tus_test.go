@@ -0,0 +1,243 @@
+package regia
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tusClient struct {
+	t       *testing.T
+	engine  *Engine
+	storage *MemoryFileStorage
+	tus     *TusHandler
+}
+
+func newTusClient(t *testing.T) *tusClient {
+	t.Helper()
+	storage := NewMemoryFileStorage()
+	tus := NewTusHandler()
+	tus.Storage = storage
+	engine := New()
+	tus.Register(engine.Branch, "/files")
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	return &tusClient{t: t, engine: engine, storage: storage, tus: tus}
+}
+
+func (c *tusClient) do(method, path string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	request := httptest.NewRequest(method, path, body)
+	request.Header.Set("Tus-Resumable", tusVersion)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	c.engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (c *tusClient) create(size string, headers ...string) string {
+	c.t.Helper()
+	resp := c.do(http.MethodPost, "/files", nil, append([]string{"Upload-Length", size}, headers...)...)
+	if resp.Code != http.StatusCreated {
+		c.t.Fatalf("create: %d %s", resp.Code, resp.Body)
+	}
+	return resp.Header().Get("Location")
+}
+
+func (c *tusClient) patch(location, offset string, body io.Reader) *httptest.ResponseRecorder {
+	c.t.Helper()
+	return c.do(http.MethodPatch, location, body, contentType, tusContentType, "Upload-Offset", offset)
+}
+
+func (c *tusClient) expectOffset(location string, status int, offset string) {
+	c.t.Helper()
+	resp := c.do(http.MethodHead, location, nil)
+	if resp.Code != status || resp.Header().Get("Upload-Offset") != offset {
+		c.t.Fatalf("HEAD = %d, Upload-Offset %q, expected %d %q", resp.Code, resp.Header().Get("Upload-Offset"), status, offset)
+	}
+}
+
+// the names in the storage with the chunk prefix
+func (c *tusClient) chunks() []string {
+	c.storage.mu.RLock()
+	defer c.storage.mu.RUnlock()
+	var names []string
+	for name := range c.storage.files {
+		if strings.HasPrefix(name, tusDefaultPrefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// brokenReader returns the data then fails like a broken connection
+type brokenReader struct{ data io.Reader }
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	n, err := b.data.Read(p)
+	if err == io.EOF {
+		err = errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestTusOptions(t *testing.T) {
+	c := newTusClient(t)
+	c.tus.MaxSize = 100
+	resp := c.do(http.MethodOptions, "/files", nil)
+	if resp.Code != http.StatusNoContent || resp.Header().Get("Tus-Version") != tusVersion ||
+		resp.Header().Get("Tus-Extension") != tusExtensions || resp.Header().Get("Tus-Max-Size") != "100" {
+		t.Fatalf("OPTIONS = %d %v", resp.Code, resp.Header())
+	}
+
+	tests := []struct {
+		name    string
+		headers []string
+		status  int
+	}{
+		{"version", []string{"Tus-Resumable", "0.2.0", "Upload-Length", "10"}, http.StatusPreconditionFailed},
+		{"no length", nil, http.StatusBadRequest},
+		{"negative length", []string{"Upload-Length", "-1"}, http.StatusBadRequest},
+		{"too large", []string{"Upload-Length", "101"}, http.StatusRequestEntityTooLarge},
+		{"metadata", []string{"Upload-Length", "10", "Upload-Metadata", "filename !!!"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if resp := c.do(http.MethodPost, "/files", nil, test.headers...); resp.Code != test.status {
+			t.Errorf("%s: create = %d", test.name, resp.Code)
+		}
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	c := newTusClient(t)
+	var completed *TusUpload
+	c.tus.OnComplete = func(ctx *Context, upload *TusUpload) { completed = upload }
+	// filename a.txt
+	location := c.create("11", "Upload-Metadata", "filename YS50eHQ=,empty")
+	if !strings.HasPrefix(location, "/files/") {
+		t.Fatalf("Location = %q", location)
+	}
+
+	resp := c.do(http.MethodHead, location, nil)
+	if resp.Code != http.StatusOK || resp.Header().Get("Upload-Offset") != "0" || resp.Header().Get("Upload-Length") != "11" ||
+		resp.Header().Get("Upload-Metadata") != "filename YS50eHQ=,empty" || resp.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("HEAD = %d %v", resp.Code, resp.Header())
+	}
+
+	if resp := c.do(http.MethodPatch, location, strings.NewReader("hello"), "Upload-Offset", "0"); resp.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("PATCH without the tus content type = %d", resp.Code)
+	}
+	if resp := c.patch(location, "0", strings.NewReader("hello")); resp.Code != http.StatusNoContent || resp.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("PATCH = %d %v", resp.Code, resp.Header())
+	}
+	c.expectOffset(location, http.StatusOK, "5")
+
+	// the offset must be the one the server has
+	for _, offset := range []string{"0", "3", "11", ""} {
+		if resp := c.patch(location, offset, strings.NewReader(" world")); resp.Code != http.StatusConflict {
+			t.Fatalf("PATCH at %q = %d", offset, resp.Code)
+		}
+	}
+
+	// the data received before the connection is broken is kept
+	c.patch(location, "5", &brokenReader{data: strings.NewReader(" wo")})
+	c.expectOffset(location, http.StatusOK, "8")
+	if n := len(c.chunks()); n != 2 {
+		t.Fatalf("%d chunks stored", n)
+	}
+
+	// resume, the bytes beyond Upload-Length are ignored
+	if resp := c.patch(location, "8", strings.NewReader("rld!!!")); resp.Code != http.StatusNoContent || resp.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("last PATCH = %d %v", resp.Code, resp.Header())
+	}
+	if completed == nil || !strings.HasSuffix(completed.Name, ".txt") || completed.Metadata["filename"] != "a.txt" {
+		t.Fatalf("OnComplete got %+v", completed)
+	}
+	if content := readStored(t, c.storage, completed.Name); content != "hello world" {
+		t.Fatalf("stored %q", content)
+	}
+	if chunks := c.chunks(); len(chunks) != 0 {
+		t.Fatalf("chunks are left: %v", chunks)
+	}
+
+	// a client lost the last response confirms the completion
+	c.expectOffset(location, http.StatusOK, "11")
+	name := completed.Name
+	completed = nil
+	if resp := c.patch(location, "11", strings.NewReader("")); resp.Code != http.StatusNoContent || resp.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("PATCH again = %d %v", resp.Code, resp.Header())
+	}
+	if completed != nil {
+		t.Fatal("completed twice")
+	}
+
+	if resp := c.do(http.MethodDelete, location, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.Code)
+	}
+	c.expectOffset(location, http.StatusNotFound, "")
+	// the completed file belongs to the application
+	if _, err := c.storage.Stat(name); err != nil {
+		t.Fatalf("the completed file is deleted: %v", err)
+	}
+}
+
+func TestTusEmptyUpload(t *testing.T) {
+	c := newTusClient(t)
+	var completed *TusUpload
+	c.tus.OnComplete = func(ctx *Context, upload *TusUpload) { completed = upload }
+	location := c.create("0")
+	if completed == nil || readStored(t, c.storage, completed.Name) != "" {
+		t.Fatalf("OnComplete got %+v", completed)
+	}
+	c.expectOffset(location, http.StatusOK, "0")
+}
+
+func TestTusTerminate(t *testing.T) {
+	c := newTusClient(t)
+	location := c.create("10")
+	c.patch(location, "0", strings.NewReader("hello"))
+	if resp := c.do(http.MethodDelete, location, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", resp.Code)
+	}
+	if chunks := c.chunks(); len(chunks) != 0 {
+		t.Fatalf("chunks are left: %v", chunks)
+	}
+	if resp := c.patch(location, "5", strings.NewReader("world")); resp.Code != http.StatusNotFound {
+		t.Fatalf("PATCH after DELETE = %d", resp.Code)
+	}
+}
+
+func TestTusExpiration(t *testing.T) {
+	c := newTusClient(t)
+	c.tus.Expiration = 50 * time.Millisecond
+	location := c.create("10")
+	resp := c.patch(location, "0", strings.NewReader("hello"))
+	expires, err := http.ParseTime(resp.Header().Get("Upload-Expires"))
+	if err != nil || expires.Before(time.Now().Add(-time.Second)) {
+		t.Fatalf("Upload-Expires = %q", resp.Header().Get("Upload-Expires"))
+	}
+	completed := c.create("1")
+	c.patch(completed, "0", strings.NewReader("x"))
+	swept := c.create("10")
+	c.patch(swept, "0", strings.NewReader("hello"))
+
+	time.Sleep(100 * time.Millisecond)
+	c.expectOffset(location, http.StatusGone, "")
+	if resp := c.patch(completed, "1", strings.NewReader("")); resp.Code != http.StatusGone {
+		t.Fatalf("PATCH of an expired completed upload = %d", resp.Code)
+	}
+	// the uploads never visited again are swept by the next creation
+	c.tus.lastSweep = time.Time{}
+	c.create("10")
+	if chunks := c.chunks(); len(chunks) != 0 {
+		t.Fatalf("chunks are left: %v", chunks)
+	}
+	c.expectOffset(swept, http.StatusNotFound, "")
+}
@@ -0,0 +1,214 @@
+package regia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// UploadPolicy limits the uploaded files before they are saved,
+// attach it to a route like `engine.POST("/upload", policy.Handle, upload)`.
+// Handle parses the whole multipart form up to MaxRequestSize before checking,
+// so Request.MultipartReader can not be used after it, stream the upload with
+// UploadPolicy.MultipartReader instead to check every file while reading it.
+type UploadPolicy struct {
+	// Max size of the whole request body, 0 means no limit
+	MaxRequestSize int64
+
+	// Max size of every file, 0 means no limit
+	MaxFileSize int64
+
+	// Max count of files per field, 0 means no limit
+	MaxFiles int
+
+	// MIME types detected by sniffing the content rather than the client header,
+	// `image/*` is supported, empty means allow all
+	AllowedTypes []string
+
+	// Extensions such as `.png`, case insensitive, empty means allow all
+	AllowedExtensions []string
+}
+
+// UploadError is returned if the upload violates the policy
+type UploadError struct {
+	// http.StatusRequestEntityTooLarge or http.StatusUnsupportedMediaType
+	Status   int
+	Field    string
+	Filename string
+	Reason   string
+}
+
+func (e *UploadError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("upload rejected: %s", e.Reason)
+	}
+	if e.Filename == "" {
+		return fmt.Sprintf("upload rejected: %s: %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("upload rejected: %s %q: %s", e.Field, e.Filename, e.Reason)
+}
+
+// Handle checks the uploaded files and aborts the request with 413 or 415 if they violate the policy
+func (p UploadPolicy) Handle(ctx *Context) {
+	if p.MaxRequestSize > 0 {
+		if ctx.Raw.Request.ContentLength > p.MaxRequestSize {
+			p.reject(ctx, &UploadError{Status: http.StatusRequestEntityTooLarge, Reason: "request body too large"})
+		}
+		ctx.Raw.Request.Body = http.MaxBytesReader(ctx.Raw.Writer, ctx.Raw.Request.Body, p.MaxRequestSize)
+	}
+	files, err := ctx.Request.Files()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			p.reject(ctx, &UploadError{Status: http.StatusRequestEntityTooLarge, Reason: "request body too large"})
+		}
+		// not a multipart request, leave it to the handler
+		return
+	}
+	if err := p.Check(files); err != nil {
+		p.reject(ctx, err)
+	}
+}
+
+func (p UploadPolicy) reject(ctx *Context, err error) {
+	status := http.StatusBadRequest
+	if e, ok := err.(*UploadError); ok {
+		status = e.Status
+	}
+	http.Error(ctx.Raw.Writer, err.Error(), status)
+	ctx.Abort()
+}
+
+// Check checks all the files
+func (p UploadPolicy) Check(files Files) error {
+	for field := range files {
+		all, err := files.GetAll(field)
+		if err != nil {
+			return err
+		}
+		if p.MaxFiles > 0 && len(all) > p.MaxFiles {
+			return &UploadError{
+				Status: http.StatusRequestEntityTooLarge,
+				Field:  field,
+				Reason: fmt.Sprintf("%d files exceed the limit %d", len(all), p.MaxFiles),
+			}
+		}
+		for _, file := range all {
+			if err := p.CheckFile(field, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckFile checks the size, extension and sniffed content type of the file
+func (p UploadPolicy) CheckFile(field string, file *File) error {
+	if p.MaxFileSize > 0 && file.Size > p.MaxFileSize {
+		return uploadRejected(http.StatusRequestEntityTooLarge, field, file.Filename,
+			"size %d exceeds the limit %d", file.Size, p.MaxFileSize)
+	}
+	if err := p.checkExtension(field, file.Filename); err != nil {
+		return err
+	}
+	if len(p.AllowedTypes) > 0 {
+		detected, err := file.ContentType()
+		if err != nil {
+			return err
+		}
+		return p.checkType(field, file.Filename, detected)
+	}
+	return nil
+}
+
+// MultipartReader returns the streaming reader of the request with the policy applied,
+// NextPart returns *UploadError if a file part has too many siblings of its field,
+// a disallowed extension or a disallowed sniffed type,
+// and reading a file part beyond MaxFileSize returns *UploadError
+func (p UploadPolicy) MultipartReader(ctx *Context) (*MultipartReader, error) {
+	if p.MaxRequestSize > 0 {
+		if ctx.Raw.Request.ContentLength > p.MaxRequestSize {
+			return nil, &UploadError{Status: http.StatusRequestEntityTooLarge, Reason: "request body too large"}
+		}
+		ctx.Raw.Request.Body = http.MaxBytesReader(ctx.Raw.Writer, ctx.Raw.Request.Body, p.MaxRequestSize)
+	}
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	reader.policy = &p
+	reader.files = make(map[string]int)
+	return reader, nil
+}
+
+// checks a file part before it is read, files counts the parts of every field
+func (p UploadPolicy) checkPart(part *Part, files map[string]int) error {
+	field, filename := part.FormName(), part.FileName()
+	files[field]++
+	if p.MaxFiles > 0 && files[field] > p.MaxFiles {
+		return uploadRejected(http.StatusRequestEntityTooLarge, field, "",
+			"more than %d files", p.MaxFiles)
+	}
+	if err := p.checkExtension(field, filename); err != nil {
+		return err
+	}
+	if p.MaxFileSize > 0 && (part.maxSize <= 0 || p.MaxFileSize < part.maxSize) {
+		part.maxSize = p.MaxFileSize
+		part.tooLarge = uploadRejected(http.StatusRequestEntityTooLarge, field, filename,
+			"size exceeds the limit %d", p.MaxFileSize)
+	}
+	if len(p.AllowedTypes) == 0 {
+		return nil
+	}
+	// sniff the head of the part and put it back in front of the rest
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part.Part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	part.source = io.MultiReader(bytes.NewReader(head[:n]), part.Part)
+	return p.checkType(field, filename, http.DetectContentType(head[:n]))
+}
+
+func (p UploadPolicy) checkExtension(field, filename string) error {
+	if len(p.AllowedExtensions) == 0 {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, e := range p.AllowedExtensions {
+		if strings.ToLower(e) == ext {
+			return nil
+		}
+	}
+	return uploadRejected(http.StatusUnsupportedMediaType, field, filename, "extension %q is not allowed", ext)
+}
+
+func (p UploadPolicy) checkType(field, filename, detected string) error {
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		detected = mediaType
+	}
+	for _, t := range p.AllowedTypes {
+		if mediaTypeMatch(strings.ToLower(t), detected) {
+			return nil
+		}
+	}
+	return uploadRejected(http.StatusUnsupportedMediaType, field, filename, "content type %q is not allowed", detected)
+}
+
+func uploadRejected(status int, field, filename, format string, a ...interface{}) *UploadError {
+	return &UploadError{Status: status, Field: field, Filename: filename, Reason: fmt.Sprintf(format, a...)}
+}
+
+// the exact `type/subtype` or `type/*`, the subtype is never matched by prefix,
+// so `text/x` does not allow `text/x-foo`
+func mediaTypeMatch(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+}
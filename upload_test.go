@@ -0,0 +1,147 @@
+package regia
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testPNG = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestUploadPolicyHandle(t *testing.T) {
+	policy := UploadPolicy{
+		MaxRequestSize:    1 << 10,
+		MaxFileSize:       64,
+		MaxFiles:          2,
+		AllowedTypes:      []string{"image/*"},
+		AllowedExtensions: []string{".PNG"},
+	}
+	png := func(name string) testPart { return testPart{field: "file", filename: name, content: testPNG} }
+	tests := []struct {
+		name   string
+		parts  []testPart
+		status int
+	}{
+		{"allowed", []testPart{png("a.png"), png("b.Png"), {field: "title", content: "x"}}, http.StatusOK},
+		{"too many files", []testPart{png("a.png"), png("b.png"), png("c.png")}, http.StatusRequestEntityTooLarge},
+		{"extension", []testPart{png("a.gif")}, http.StatusUnsupportedMediaType},
+		{"sniffed type", []testPart{{field: "file", filename: "a.png", content: "plain text"}}, http.StatusUnsupportedMediaType},
+		{"file size", []testPart{{field: "file", filename: "a.png", content: testPNG + strings.Repeat("x", 64)}}, http.StatusRequestEntityTooLarge},
+		{"request size", []testPart{{field: "file", filename: "a.png", content: testPNG + strings.Repeat("x", 1<<10)}}, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		for _, chunked := range []bool{false, true} {
+			engine := New()
+			handled := false
+			engine.POST("/upload", policy.Handle, func(ctx *Context) { handled = true })
+			request := newMultipartRequest("/upload", test.parts...)
+			if chunked {
+				// the size is unknown before reading
+				request.ContentLength = -1
+			}
+			recorder := serveTest(t, engine, request)
+			if status := recorder.Code; status != test.status || handled != (status == http.StatusOK) {
+				t.Errorf("%s (chunked %v): status %d, handled %v, %s", test.name, chunked, status, handled, recorder.Body)
+			}
+		}
+	}
+
+	// not a multipart request, leave it to the handler
+	engine := New()
+	engine.POST("/upload", policy.Handle, func(ctx *Context) { _, _ = ctx.Response.String("handled") })
+	request := newMultipartRequest("/upload")
+	request.Header.Set(contentType, jsonContentType)
+	if recorder := serveTest(t, engine, request); recorder.Body.String() != "handled" {
+		t.Fatalf("non multipart request got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestMediaTypeMatch(t *testing.T) {
+	tests := []struct {
+		pattern, mediaType string
+		match              bool
+	}{
+		{"image/png", "image/png", true},
+		{"image/*", "image/png", true},
+		{"*/*", "text/plain", true},
+		{"text/x", "text/x-foo", false},
+		{"image/*", "imagex/png", false},
+		{"text/plain", "text/html", false},
+	}
+	for _, test := range tests {
+		if match := mediaTypeMatch(test.pattern, test.mediaType); match != test.match {
+			t.Errorf("mediaTypeMatch(%q, %q) = %v", test.pattern, test.mediaType, match)
+		}
+	}
+}
+
+func TestUploadPolicyMultipartReader(t *testing.T) {
+	policy := UploadPolicy{
+		MaxFileSize:       64,
+		MaxFiles:          2,
+		AllowedTypes:      []string{"image/png"},
+		AllowedExtensions: []string{".png"},
+	}
+	upload := func(parts ...testPart) ([]string, *MemoryFileStorage, error) {
+		storage := NewMemoryFileStorage()
+		engine := New()
+		engine.FileStorage = storage
+		var names []string
+		var uploadErr error
+		engine.POST("/upload", func(ctx *Context) {
+			reader, err := policy.MultipartReader(ctx)
+			for err == nil {
+				var part *Part
+				if part, err = reader.NextPart(); err == nil && part.IsFile() {
+					var name string
+					if name, err = ctx.SaveUploadPart(part, part.FileName()); err == nil {
+						names = append(names, name)
+					}
+				}
+			}
+			if err != io.EOF {
+				uploadErr = err
+			}
+		})
+		serveTest(t, engine, newMultipartRequest("/upload", parts...))
+		return names, storage, uploadErr
+	}
+
+	// the sniffed head is put back, the whole file is stored
+	content := testPNG + strings.Repeat("x", 40)
+	names, storage, err := upload(testPart{field: "title", content: "not checked"}, testPart{field: "file", filename: "a.png", content: content})
+	if err != nil || len(names) != 1 || readStored(t, storage, "a.png") != content {
+		t.Fatalf("allowed upload: %v, %v", names, err)
+	}
+
+	png := testPart{field: "file", filename: "a.png", content: testPNG}
+	tests := []struct {
+		name   string
+		parts  []testPart
+		stored int
+		status int
+	}{
+		{"too many files", []testPart{png, png, png}, 2, http.StatusRequestEntityTooLarge},
+		{"extension", []testPart{png, {field: "file", filename: "a.jpg", content: testPNG}}, 1, http.StatusUnsupportedMediaType},
+		{"sniffed type", []testPart{{field: "file", filename: "a.png", content: "GIF89a"}}, 0, http.StatusUnsupportedMediaType},
+		{"file size", []testPart{{field: "file", filename: "a.png", content: testPNG + strings.Repeat("x", 64)}}, 0, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		names, _, err := upload(test.parts...)
+		var uploadErr *UploadError
+		if !errors.As(err, &uploadErr) || uploadErr.Status != test.status || len(names) != test.stored {
+			t.Errorf("%s: stored %v, %v", test.name, names, err)
+		}
+	}
+
+	// Handle parses the whole form, the streaming reader can not be used after it
+	engine := New()
+	engine.POST("/upload", policy.Handle, func(ctx *Context) {
+		if _, err := ctx.Request.MultipartReader(); err != multipartParsedError {
+			t.Errorf("MultipartReader after Handle = %v", err)
+		}
+	})
+	serveTest(t, engine, newMultipartRequest("/upload", png))
+}
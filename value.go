@@ -2,6 +2,7 @@ package regia
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
 	"strconv"
 	"sync"
@@ -127,6 +128,14 @@ func (v Value) ParseTime(layout string) (time.Time, error) {
 	return time.Time{}, v.err
 }
 
+// Parse time in http header format, such as `Mon, 02 Jan 2006 15:04:05 GMT`
+func (v Value) HttpTime() (time.Time, error) {
+	if v.IsValid() && !v.IsEmpty() {
+		return http.ParseTime(v.data)
+	}
+	return time.Time{}, v.err
+}
+
 func (v Value) IsEmpty() bool {
 	return v.data == ""
 }
@@ -0,0 +1,586 @@
+package regia
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Message types of WebSocket, the same as the frame opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes defined in RFC 6455, section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	defaultReadLimit        = 32 << 20 // 32 MB
+	maxControlFramePayload  = 125
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+var (
+	badHandshakeError      = errors.New("websocket: bad handshake")
+	hijackUnsupportedError = errors.New("websocket: response does not implement http.Hijacker")
+	writeClosedError       = errors.New("websocket: write to closed connection")
+)
+
+// CloseError is returned by ReadMessage after the close frame received
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// UpgradeOptions configures the WebSocket handshake
+type UpgradeOptions struct {
+	// Subprotocols supported by server in order of preference
+	Subprotocols []string
+
+	// CheckOrigin returns false to reject the request, default rejects the cross origin requests
+	CheckOrigin func(ctx *Context) bool
+
+	// Max size of a message, default 32MB
+	ReadLimit int64
+
+	// Header added to the handshake response
+	Header http.Header
+}
+
+// Upgrade upgrades the request to WebSocket protocol,
+// it runs in the handler chain so middlewares and Interceptors still run before it.
+// The handler should keep using the returned connection and must not write to the Response.
+func (c *Context) Upgrade(options ...UpgradeOptions) (*WebSocketConn, error) {
+	var opts UpgradeOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	req := c.Raw.Request
+	fail := func(code int, reason string) (*WebSocketConn, error) {
+		http.Error(c.Raw.Writer, reason, code)
+		return nil, fmt.Errorf("%w: %s", badHandshakeError, reason)
+	}
+	if req.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "method is not GET")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		c.Raw.Writer.Header().Set("Sec-Websocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(c) {
+		return fail(http.StatusForbidden, "origin not allowed")
+	}
+	key := req.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	// HTTP/2 can not be hijacked
+	hijacker, ok := c.Raw.Writer.(http.Hijacker)
+	if !ok || !canHijack(c.Raw.Writer) {
+		http.Error(c.Raw.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, hijackUnsupportedError
+	}
+	protocol := selectSubprotocol(req.Header, opts.Subprotocols)
+
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if rw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, fmt.Errorf("%w: client sent data before handshake completed", badHandshakeError)
+	}
+	var response strings.Builder
+	response.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	response.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n")
+	if protocol != "" {
+		response.WriteString("Sec-WebSocket-Protocol: " + protocol + "\r\n")
+	}
+	for name, values := range opts.Header {
+		for _, value := range values {
+			response.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	response.WriteString("\r\n")
+	_ = netConn.SetWriteDeadline(time.Now().Add(defaultHandshakeTimeout))
+	if _, err := netConn.Write([]byte(response.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	_ = netConn.SetWriteDeadline(time.Time{})
+	conn := newWebSocketConn(netConn, rw.Reader, true, opts.ReadLimit)
+	conn.subprotocol = protocol
+	conn.serializer = c.Engine.JsonSerializer
+	return conn, nil
+}
+
+// DialWebSocket connects to the WebSocket server, such as `ws://127.0.0.1:8000/ws`
+func DialWebSocket(rawURL string, header http.Header) (*WebSocketConn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	netConn, err := net.DialTimeout("tcp", host, defaultHandshakeTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: make(http.Header)}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	_ = netConn.SetDeadline(time.Now().Add(defaultHandshakeTimeout))
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-Websocket-Accept") != websocketAccept(key) {
+		netConn.Close()
+		return nil, resp, badHandshakeError
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	conn := newWebSocketConn(netConn, reader, false, 0)
+	conn.subprotocol = resp.Header.Get("Sec-Websocket-Protocol")
+	return conn, resp, nil
+}
+
+// WebSocketConn is a WebSocket connection.
+// One goroutine can read and others can write concurrently.
+type WebSocketConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	server      bool
+	subprotocol string
+	readLimit   int64
+	serializer  Serializer
+
+	writeMu     sync.Mutex
+	closeSent   bool
+	pingHandler func(data string) error
+	pongHandler func(data string) error
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, server bool, readLimit int64) *WebSocketConn {
+	if readLimit <= 0 {
+		readLimit = defaultReadLimit
+	}
+	c := &WebSocketConn{conn: conn, reader: reader, server: server, readLimit: readLimit, serializer: JsonSerializer{}}
+	c.pingHandler = func(data string) error {
+		return c.WriteControl(PongMessage, []byte(data), time.Now().Add(time.Second))
+	}
+	c.pongHandler = func(string) error { return nil }
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol
+func (c *WebSocketConn) Subprotocol() string { return c.subprotocol }
+
+func (c *WebSocketConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *WebSocketConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// SetReadLimit sets the max size of a message, CloseMessageTooBig will be sent if exceeded
+func (c *WebSocketConn) SetReadLimit(limit int64) { c.readLimit = limit }
+
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error { return c.conn.SetReadDeadline(t) }
+
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+// SetPingHandler sets the handler of ping frames, default replies a pong
+func (c *WebSocketConn) SetPingHandler(handler func(data string) error) { c.pingHandler = handler }
+
+// SetPongHandler sets the handler of pong frames, default does nothing
+func (c *WebSocketConn) SetPongHandler(handler func(data string) error) { c.pongHandler = handler }
+
+type frameHeader struct {
+	fin    bool
+	opcode int
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+func (c *WebSocketConn) readFrameHeader() (frameHeader, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(c.reader, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&0x80 != 0
+	if b[0]&0x70 != 0 {
+		return h, c.protocolError(CloseProtocolError, "reserved bits set")
+	}
+	h.opcode = int(b[0] & 0x0f)
+	h.masked = b[1]&0x80 != 0
+	h.length = int64(b[1] & 0x7f)
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(c.reader, b[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.reader, b[:8]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint64(b[:8]))
+		if h.length < 0 {
+			return h, c.protocolError(CloseProtocolError, "invalid payload length")
+		}
+	}
+	if h.masked {
+		if _, err := io.ReadFull(c.reader, h.mask[:]); err != nil {
+			return h, err
+		}
+	}
+	// the client must mask frames and the server must not
+	if h.masked != c.server {
+		return h, c.protocolError(CloseProtocolError, "invalid mask")
+	}
+	switch h.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !h.fin || h.length > maxControlFramePayload {
+			return h, c.protocolError(CloseProtocolError, "invalid control frame")
+		}
+	default:
+		return h, c.protocolError(CloseProtocolError, "unknown opcode")
+	}
+	return h, nil
+}
+
+func (c *WebSocketConn) readPayload(h frameHeader) ([]byte, error) {
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, err
+	}
+	if h.masked {
+		maskBytes(h.mask, payload)
+	}
+	return payload, nil
+}
+
+// ReadMessage reads a complete message, the fragments are joined and
+// the control frames are handled in place.
+// *CloseError is returned after the close frame received or sent for protocol errors,
+// the connection should be closed then.
+func (c *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	for {
+		h, err := c.readFrameHeader()
+		if err != nil {
+			return 0, nil, err
+		}
+		if h.opcode >= CloseMessage {
+			if err := c.handleControl(h); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		if messageType == 0 && h.opcode == continuationFrame {
+			return 0, nil, c.protocolError(CloseProtocolError, "unexpected continuation frame")
+		}
+		if messageType != 0 && h.opcode != continuationFrame {
+			return 0, nil, c.protocolError(CloseProtocolError, "expected continuation frame")
+		}
+		if messageType == 0 {
+			messageType = h.opcode
+		}
+		if int64(len(data))+h.length > c.readLimit {
+			return 0, nil, c.protocolError(CloseMessageTooBig, "message too big")
+		}
+		payload, err := c.readPayload(h)
+		if err != nil {
+			return 0, nil, err
+		}
+		data = append(data, payload...)
+		if h.fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, c.protocolError(CloseInvalidFramePayloadData, "invalid utf8")
+			}
+			return messageType, data, nil
+		}
+	}
+}
+
+func (c *WebSocketConn) handleControl(h frameHeader) error {
+	payload, err := c.readPayload(h)
+	if err != nil {
+		return err
+	}
+	switch h.opcode {
+	case PingMessage:
+		return c.pingHandler(string(payload))
+	case PongMessage:
+		return c.pongHandler(string(payload))
+	}
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+	} else if len(payload) == 1 {
+		return c.protocolError(CloseProtocolError, "invalid close payload")
+	}
+	// echo the close frame
+	code := closeErr.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	_ = c.WriteControl(CloseMessage, FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	return closeErr
+}
+
+// send the close frame and return the error
+func (c *WebSocketConn) protocolError(code int, text string) error {
+	_ = c.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	return &CloseError{Code: code, Text: text}
+}
+
+// WriteMessage writes a text or binary message as one frame
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return c.WriteControl(messageType, data, time.Time{})
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrame(true, messageType, data)
+}
+
+// WriteFragments writes a message as several frames
+func (c *WebSocketConn) WriteFragments(messageType int, fragments ...[]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for i, fragment := range fragments {
+		opcode := messageType
+		if i > 0 {
+			opcode = continuationFrame
+		}
+		if err := c.writeFrame(i == len(fragments)-1, opcode, fragment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJson writes a text message serialized by Engine.JsonSerializer
+func (c *WebSocketConn) WriteJson(v interface{}) error {
+	data, err := c.serializer.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// ReadJson reads a message and unmarshal it by Engine.JsonSerializer
+func (c *WebSocketConn) ReadJson(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return c.serializer.Unmarshal(data, v)
+}
+
+// WriteControl writes a close, ping or pong frame with the deadline
+func (c *WebSocketConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if len(data) > maxControlFramePayload {
+		return errors.New("websocket: control frame too large")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !deadline.IsZero() {
+		_ = c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return c.writeFrame(true, messageType, data)
+}
+
+func (c *WebSocketConn) writeFrame(fin bool, opcode int, data []byte) error {
+	if c.closeSent {
+		return writeClosedError
+	}
+	header := make([]byte, 2, 14)
+	header[0] = byte(opcode)
+	if fin {
+		header[0] |= 0x80
+	}
+	length := len(data)
+	switch {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = append(header, byte(length>>8), byte(length))
+	default:
+		header[1] = 127
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(length))
+		header = append(header, b[:]...)
+	}
+	if c.server {
+		header = append(header, data...)
+	} else {
+		// the client must mask the payload
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		header = append(header, mask[:]...)
+		offset := len(header)
+		header = append(header, data...)
+		maskBytes(mask, header[offset:])
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	_, err := c.conn.Write(header)
+	return err
+}
+
+// CloseWithCode sends the close frame, waits for the peer's close frame a moment and closes the connection
+func (c *WebSocketConn) CloseWithCode(code int, text string) error {
+	err := c.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	if err == writeClosedError {
+		return c.conn.Close()
+	}
+	if err == nil {
+		// drain until the close frame of the peer received
+		_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+	return c.conn.Close()
+}
+
+// Close closes the underlying connection without close handshake
+func (c *WebSocketConn) Close() error {
+	return c.conn.Close()
+}
+
+// FormatCloseMessage formats the payload of the close frame
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	if len(payload) > maxControlFramePayload {
+		payload = payload[:maxControlFramePayload]
+	}
+	return payload
+}
+
+func maskBytes(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(header http.Header, supported []string) string {
+	for _, protocol := range supported {
+		if headerContainsToken(header, "Sec-Websocket-Protocol", protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// the request without Origin header is allowed, it is not sent by a browser
+func sameOrigin(ctx *Context) bool {
+	origin := ctx.Raw.Request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, ctx.Raw.Request.Host)
+}
@@ -0,0 +1,434 @@
+package regia
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newWebSocketServer serves the handler at `/ws` and returns the url to dial
+func newWebSocketServer(t *testing.T, engine *Engine, group ...HandleFunc) string {
+	t.Helper()
+	if engine == nil {
+		engine = New()
+	}
+	engine.GET("/ws", group...)
+	if err := engine.init(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// echoHandler echoes the messages and sends the error of ReadMessage to errs
+func echoHandler(errs chan<- error, options ...UpgradeOptions) HandleFunc {
+	return func(ctx *Context) {
+		conn, err := ctx.Upgrade(options...)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+}
+
+func dialWebSocket(t *testing.T, url string, header http.Header) *WebSocketConn {
+	t.Helper()
+	conn, _, err := DialWebSocket(url, header)
+	if err != nil {
+		t.Fatalf("DialWebSocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func expectMessage(t *testing.T, conn *WebSocketConn, messageType int, data []byte) {
+	t.Helper()
+	gotType, got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if gotType != messageType || !bytes.Equal(got, data) {
+		t.Fatalf("ReadMessage = %d %q, want %d %q", gotType, truncate(got), messageType, truncate(data))
+	}
+}
+
+func expectCloseError(t *testing.T, err error, code int) {
+	t.Helper()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != code {
+		t.Fatalf("error = %v, want close %d", err, code)
+	}
+}
+
+func receiveError(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server")
+		return nil
+	}
+}
+
+func truncate(data []byte) []byte {
+	if len(data) > 32 {
+		return data[:32]
+	}
+	return data
+}
+
+func TestWebSocketRoundTrip(t *testing.T) {
+	errs := make(chan error, 1)
+	conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+
+	cases := []struct {
+		messageType int
+		data        []byte
+	}{
+		{TextMessage, []byte("hello 世界")},
+		{TextMessage, []byte{}},
+		{BinaryMessage, []byte{0, 1, 2, 0xff}},
+		// 16 bit length
+		{BinaryMessage, bytes.Repeat([]byte{7}, 300)},
+		// 64 bit length
+		{BinaryMessage, bytes.Repeat([]byte{9}, 70000)},
+	}
+	for _, c := range cases {
+		if err := conn.WriteMessage(c.messageType, c.data); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, conn, c.messageType, c.data)
+	}
+
+	if err := conn.WriteJson(Map{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]int
+	if err := conn.ReadJson(&v); err != nil || v["a"] != 1 {
+		t.Fatalf("ReadJson = %v, %v", v, err)
+	}
+}
+
+func TestWebSocketFragments(t *testing.T) {
+	errs := make(chan error, 1)
+	conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+
+	if err := conn.WriteFragments(TextMessage, []byte("hel"), []byte("lo "), []byte("世界")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, conn, TextMessage, []byte("hello 世界"))
+
+	// a control frame may be injected between the fragments
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+	conn.writeMu.Lock()
+	for _, frame := range []struct {
+		fin    bool
+		opcode int
+		data   string
+	}{
+		{false, BinaryMessage, "ab"},
+		{true, PingMessage, "between"},
+		{false, continuationFrame, "cd"},
+		{true, continuationFrame, "ef"},
+	} {
+		if err := conn.writeFrame(frame.fin, frame.opcode, []byte(frame.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.writeMu.Unlock()
+	expectMessage(t, conn, BinaryMessage, []byte("abcdef"))
+	if pong := <-pongs; pong != "between" {
+		t.Fatalf("pong = %q", pong)
+	}
+
+	// a continuation frame can not start a message
+	conn.writeMu.Lock()
+	_ = conn.writeFrame(true, continuationFrame, []byte("x"))
+	conn.writeMu.Unlock()
+	expectCloseError(t, receiveError(t, errs), CloseProtocolError)
+	_, _, err := conn.ReadMessage()
+	expectCloseError(t, err, CloseProtocolError)
+}
+
+func TestWebSocketPingPong(t *testing.T) {
+	serverPongs := make(chan string, 1)
+	errs := make(chan error, 1)
+	url := newWebSocketServer(t, nil, func(ctx *Context) {
+		conn, err := ctx.Upgrade()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetPongHandler(func(data string) error {
+			serverPongs <- data
+			return nil
+		})
+		if err := conn.WriteControl(PingMessage, []byte("from server"), time.Now().Add(time.Second)); err != nil {
+			errs <- err
+			return
+		}
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			_ = conn.WriteMessage(messageType, data)
+		}
+	})
+	conn := dialWebSocket(t, url, nil)
+	clientPongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		clientPongs <- data
+		return nil
+	})
+	if err := conn.WriteControl(PingMessage, []byte("from client"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("after ping")); err != nil {
+		t.Fatal(err)
+	}
+	// the ping of server is answered and the pong is handled in ReadMessage
+	expectMessage(t, conn, TextMessage, []byte("after ping"))
+	if pong := <-clientPongs; pong != "from client" {
+		t.Fatalf("client pong = %q", pong)
+	}
+	select {
+	case pong := <-serverPongs:
+		if pong != "from server" {
+			t.Fatalf("server pong = %q", pong)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not receive the pong")
+	}
+	if err := conn.WriteControl(PingMessage, bytes.Repeat([]byte("x"), 126), time.Time{}); err == nil {
+		t.Fatal("a control frame larger than 125 bytes should be rejected")
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		errs := make(chan error, 1)
+		conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+		if err := conn.CloseWithCode(CloseGoingAway, "bye"); err != nil {
+			t.Fatal(err)
+		}
+		err := receiveError(t, errs)
+		expectCloseError(t, err, CloseGoingAway)
+		if text := err.(*CloseError).Text; text != "bye" {
+			t.Fatalf("close text = %q", text)
+		}
+		if err := conn.WriteMessage(TextMessage, []byte("x")); err == nil {
+			t.Fatal("write after close should fail")
+		}
+	})
+
+	t.Run("server", func(t *testing.T) {
+		url := newWebSocketServer(t, nil, func(ctx *Context) {
+			conn, err := ctx.Upgrade()
+			if err == nil {
+				_ = conn.CloseWithCode(4000, "custom")
+			}
+		})
+		conn := dialWebSocket(t, url, nil)
+		_, _, err := conn.ReadMessage()
+		expectCloseError(t, err, 4000)
+	})
+
+	t.Run("no status", func(t *testing.T) {
+		errs := make(chan error, 1)
+		conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+		if err := conn.WriteControl(CloseMessage, FormatCloseMessage(CloseNoStatusReceived, ""), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		expectCloseError(t, receiveError(t, errs), CloseNoStatusReceived)
+		// the server echoes the normal closure
+		_, _, err := conn.ReadMessage()
+		expectCloseError(t, err, CloseNormalClosure)
+	})
+
+	t.Run("invalid utf8", func(t *testing.T) {
+		errs := make(chan error, 1)
+		conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+		if err := conn.WriteMessage(TextMessage, []byte{0xff, 0xfe}); err != nil {
+			t.Fatal(err)
+		}
+		expectCloseError(t, receiveError(t, errs), CloseInvalidFramePayloadData)
+		_, _, err := conn.ReadMessage()
+		expectCloseError(t, err, CloseInvalidFramePayloadData)
+	})
+
+	t.Run("unmasked", func(t *testing.T) {
+		errs := make(chan error, 1)
+		conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs)), nil)
+		// frames of the server side are not masked
+		conn.server = true
+		_ = conn.WriteMessage(TextMessage, []byte("unmasked"))
+		expectCloseError(t, receiveError(t, errs), CloseProtocolError)
+	})
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	errs := make(chan error, 1)
+	conn := dialWebSocket(t, newWebSocketServer(t, nil, echoHandler(errs, UpgradeOptions{ReadLimit: 10})), nil)
+	if err := conn.WriteMessage(BinaryMessage, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, conn, BinaryMessage, make([]byte, 10))
+	// the limit applies to the whole message of fragments
+	if err := conn.WriteFragments(BinaryMessage, make([]byte, 6), make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	expectCloseError(t, receiveError(t, errs), CloseMessageTooBig)
+	_, _, err := conn.ReadMessage()
+	expectCloseError(t, err, CloseMessageTooBig)
+}
+
+func TestWebSocketSubprotocol(t *testing.T) {
+	errs := make(chan error, 1)
+	url := newWebSocketServer(t, nil, echoHandler(errs, UpgradeOptions{
+		Subprotocols: []string{"v2.chat", "v1.chat"},
+		Header:       http.Header{"X-Server": {"regia"}},
+	}))
+	conn, resp, err := DialWebSocket(url, http.Header{"Sec-Websocket-Protocol": {"v1.chat, v2.chat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "v2.chat" || resp.Header.Get("X-Server") != "regia" {
+		t.Fatalf("subprotocol = %q, header = %v", conn.Subprotocol(), resp.Header)
+	}
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	errs := make(chan error, 16)
+	url := newWebSocketServer(t, nil, echoHandler(errs, UpgradeOptions{}))
+	httpURL := "http" + strings.TrimPrefix(url, "ws")
+	handshake := func(modify func(header http.Header)) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, httpURL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		modify(req.Header)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	cases := []struct {
+		name   string
+		modify func(header http.Header)
+		status int
+	}{
+		{"wrong version", func(h http.Header) { h.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"bad key", func(h http.Header) { h.Set("Sec-WebSocket-Key", "short") }, http.StatusBadRequest},
+		{"missing key", func(h http.Header) { h.Del("Sec-WebSocket-Key") }, http.StatusBadRequest},
+		{"not upgrade", func(h http.Header) { h.Del("Upgrade") }, http.StatusBadRequest},
+		{"cross origin", func(h http.Header) { h.Set("Origin", "http://evil.example") }, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		resp := handshake(c.modify)
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: status = %d, want %d", c.name, resp.StatusCode, c.status)
+		}
+		if err := receiveError(t, errs); !errors.Is(err, badHandshakeError) {
+			t.Errorf("%s: Upgrade error = %v", c.name, err)
+		}
+		if c.status == http.StatusUpgradeRequired && resp.Header.Get("Sec-Websocket-Version") != "13" {
+			t.Errorf("%s: missing Sec-WebSocket-Version", c.name)
+		}
+	}
+
+	// the same origin is allowed
+	host := strings.TrimPrefix(httpURL, "http://")
+	host = host[:strings.Index(host, "/")]
+	conn, _, err := DialWebSocket(url, http.Header{"Origin": {"http://" + host}})
+	if err != nil {
+		t.Fatalf("same origin: %v", err)
+	}
+	conn.Close()
+
+	if _, _, err := DialWebSocket(strings.TrimSuffix(url, "/ws")+"/missing", nil); err != badHandshakeError {
+		t.Fatalf("dial a plain route = %v", err)
+	}
+	if _, _, err := DialWebSocket("wss://127.0.0.1/ws", nil); err == nil {
+		t.Fatal("wss is not supported by DialWebSocket")
+	}
+}
+
+// lockedBuffer is written by the server goroutine
+type lockedBuffer struct {
+	buffer bytes.Buffer
+	mu     sync.Mutex
+}
+
+func (l *lockedBuffer) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buffer.Write(data)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buffer.String()
+}
+
+func TestWebSocketThroughMiddlewares(t *testing.T) {
+	log := &lockedBuffer{}
+	engine := New()
+	minLength := 0
+	engine.AddInterceptors(
+		AccessLogMiddleware(AccessLogOptions{Writer: log, Format: "{{.Route}} {{.Status}}"}),
+		CompressInterceptor(CompressOptions{MinLength: &minLength}),
+	)
+	errs := make(chan error, 1)
+	url := newWebSocketServer(t, engine, ETagMiddleware(), echoHandler(errs))
+
+	conn := dialWebSocket(t, url, http.Header{"Accept-Encoding": {"gzip, deflate"}})
+	message := bytes.Repeat([]byte("compressible "), 100)
+	if err := conn.WriteMessage(TextMessage, message); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, conn, TextMessage, message)
+	if err := conn.CloseWithCode(CloseNormalClosure, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectCloseError(t, receiveError(t, errs), CloseNormalClosure)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for log.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if line := log.String(); line != "/ws 101\n" {
+		t.Fatalf("access log = %q", line)
+	}
+}